@@ -3,9 +3,11 @@ package main
 import (
 	"log"
 	"net/http"
+	"time"
 
 	"avito-shop/internal/config"
 	"avito-shop/internal/handler"
+	"avito-shop/internal/models"
 	"avito-shop/internal/repository"
 	"avito-shop/internal/service"
 
@@ -25,20 +27,105 @@ func main() {
 	defer db.Close()
 
 	repo := repository.NewRepository(db)
-	svc := service.NewService(repo, cfg)
+
+	var attempts repository.LoginAttemptStore = repository.NewMemoryLoginAttemptStore()
+	if cfg.LoginAttemptStore == config.LoginAttemptStorePostgres {
+		attempts = repository.NewPostgresLoginAttemptStore(db)
+	}
+	svc := service.NewService(repo, cfg, service.WithLoginAttemptStore(attempts))
 
 	r := mux.NewRouter()
 
 	h := handler.NewHandler(svc, cfg)
 
+	r.HandleFunc("/.well-known/jwks.json", h.JWKS).Methods("GET")
+
 	authRouter := r.PathPrefix("/api").Subrouter()
 	authRouter.HandleFunc("/auth", h.Auth).Methods("POST")
+	authRouter.HandleFunc("/register", h.Register).Methods("POST")
+	authRouter.HandleFunc("/auth/refresh", h.Refresh).Methods("POST")
+	authRouter.HandleFunc("/auth/mfa", h.VerifyMFA).Methods("POST")
+	authRouter.HandleFunc("/auth/password-reset", h.ResetPassword).Methods("POST")
+	authRouter.HandleFunc("/auth/oidc/login", h.OIDCLogin).Methods("GET")
+	authRouter.HandleFunc("/auth/oidc/callback", h.OIDCCallback).Methods("GET")
 
+	// Каждый маршрут API висит на подроутере своей области: права проверяет
+	// RequireScope, а маршрута вне подроутеров быть не должно.
 	apiRouter := r.PathPrefix("/api").Subrouter()
-	apiRouter.Use(handler.JwtMiddleware(cfg.JWTSecret)) 
-	apiRouter.HandleFunc("/info", h.GetInfo).Methods("GET")
-	apiRouter.HandleFunc("/sendCoin", h.SendCoin).Methods("POST")
-	apiRouter.HandleFunc("/buy/{item}", h.BuyItem).Methods("GET")
+	apiRouter.Use(handler.JwtMiddleware(svc))
+
+	readRouter := apiRouter.NewRoute().Subrouter()
+	readRouter.Use(handler.RequireScope(models.ScopeInfoRead))
+	readRouter.HandleFunc("/info", h.GetInfo).Methods("GET")
+	readRouter.HandleFunc("/items", h.ListItems).Methods("GET")
+	readRouter.HandleFunc("/cart", h.GetCart).Methods("GET")
+	readRouter.HandleFunc("/transactions", h.ListTransactions).Methods("GET")
+	readRouter.HandleFunc("/orders", h.ListOrders).Methods("GET")
+
+	sendRouter := apiRouter.NewRoute().Subrouter()
+	sendRouter.Use(handler.RequireScope(models.ScopeCoinsSend))
+	sendRouter.HandleFunc("/sendCoin", h.SendCoin).Methods("POST")
+
+	buyRouter := apiRouter.NewRoute().Subrouter()
+	buyRouter.Use(handler.RequireScope(models.ScopeItemsBuy))
+	buyRouter.HandleFunc("/buy/{item}", h.BuyItem).Methods("GET", "POST")
+	buyRouter.HandleFunc("/cart", h.ClearCart).Methods("DELETE")
+	buyRouter.HandleFunc("/cart/items", h.AddToCart).Methods("POST")
+	buyRouter.HandleFunc("/cart/items/{item}", h.RemoveFromCart).Methods("DELETE")
+	buyRouter.HandleFunc("/checkout", h.Checkout).Methods("POST")
+	buyRouter.HandleFunc("/orders/{id:[0-9]+}/cancel", h.CancelOrder).Methods("POST")
+
+	accountRouter := apiRouter.NewRoute().Subrouter()
+	accountRouter.Use(handler.RequireScope(models.ScopeAccount))
+	accountRouter.HandleFunc("/auth/logout", h.Logout).Methods("POST")
+	accountRouter.HandleFunc("/me/password", h.ChangePassword).Methods("POST")
+	accountRouter.HandleFunc("/keys", h.CreateAPIKey).Methods("POST")
+	accountRouter.HandleFunc("/keys", h.ListAPIKeys).Methods("GET")
+	accountRouter.HandleFunc("/keys/{id:[0-9]+}", h.RevokeAPIKey).Methods("DELETE")
+	accountRouter.HandleFunc("/me/2fa/enroll", h.EnrollTOTP).Methods("POST")
+	accountRouter.HandleFunc("/me/2fa/confirm", h.ConfirmTOTP).Methods("POST")
+	accountRouter.HandleFunc("/me/2fa/disable", h.DisableTOTP).Methods("POST")
+	accountRouter.HandleFunc("/auth/oidc/link", h.OIDCLink).Methods("POST")
+
+	adminRouter := apiRouter.PathPrefix("/admin").Subrouter()
+	adminRouter.Use(handler.RequireRole(models.RoleAdmin), handler.RequireScope(models.ScopeAdmin))
+	adminRouter.HandleFunc("/items", h.CreateItem).Methods("POST")
+	adminRouter.HandleFunc("/items/{item}", h.UpdateItem).Methods("PUT")
+	adminRouter.HandleFunc("/items/{item}", h.RetireItem).Methods("DELETE")
+	adminRouter.HandleFunc("/items/{item}/restock", h.RestockItem).Methods("POST")
+	adminRouter.HandleFunc("/items/{item}/stock", h.SetItemStock).Methods("PUT")
+	adminRouter.HandleFunc("/orders", h.AdminListOrders).Methods("GET")
+	adminRouter.HandleFunc("/orders/{id:[0-9]+}/status", h.SetOrderStatus).Methods("PUT")
+	adminRouter.HandleFunc("/users/{username}/unlock", h.UnlockUser).Methods("POST")
+	adminRouter.HandleFunc("/ips/{ip}/unlock", h.UnlockIP).Methods("POST")
+	adminRouter.HandleFunc("/users/{username}/password-reset", h.CreatePasswordReset).Methods("POST")
+
+	// Ответы на запросы с Idempotency-Key хранятся cfg.IdempotencyTTL,
+	// refresh-токены — cfg.RefreshTokenTTL
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			if n, err := svc.PurgeExpiredIdempotencyKeys(); err != nil {
+				log.Printf("failed to purge idempotency keys: %v", err)
+			} else if n > 0 {
+				log.Printf("purged %d expired idempotency keys", n)
+			}
+			if n, err := svc.PurgeExpiredRefreshTokens(); err != nil {
+				log.Printf("failed to purge refresh tokens: %v", err)
+			} else if n > 0 {
+				log.Printf("purged %d expired refresh tokens", n)
+			}
+			if n, err := svc.PurgeExpiredPasswordResets(); err != nil {
+				log.Printf("failed to purge password reset tokens: %v", err)
+			} else if n > 0 {
+				log.Printf("purged %d password reset tokens", n)
+			}
+			if _, err := svc.PurgeLoginAttempts(); err != nil {
+				log.Printf("failed to purge login attempts: %v", err)
+			}
+		}
+	}()
 
 	log.Printf("Server starting at :%d\n", cfg.AppPort)
 	if err := http.ListenAndServe(cfg.Address(), r); err != nil {
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"avito-shop/internal/config"
+	"avito-shop/internal/repository"
+	"avito-shop/internal/service"
+)
+
+// reconcile сверяет users.coins с журналом проводок и печатает отчёт в JSON.
+// С флагом -repair балансы приводятся к значениям из журнала (кроме
+// отрицательных — они в negativeBalances), каждая правка пишется в audit_log.
+// Код выхода 1 — найдено расхождение, которое не было исправлено.
+func main() {
+	repair := flag.Bool("repair", false, "overwrite users.coins with the balance recomputed from the ledger")
+	flag.Parse()
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("config error: %v", err)
+	}
+
+	db, err := repository.NewPostgresDB(cfg)
+	if err != nil {
+		log.Fatalf("failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), cfg)
+
+	report, err := svc.Reconcile(*repair)
+	if err != nil {
+		log.Fatalf("reconciliation failed: %v", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		log.Fatalf("failed to write report: %v", err)
+	}
+
+	if len(report.UnbalancedTransactions) > 0 || len(report.NegativeBalances) > 0 ||
+		(len(report.Drifts) > 0 && !report.Repaired) {
+		os.Exit(1)
+	}
+}
@@ -4,6 +4,24 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
+
+	"avito-shop/internal/jwtkeys"
+)
+
+// Режимы регистрации: auto — неизвестный логин в /api/auth создаёт аккаунт
+// (удобно для разработки), explicit — аккаунт создаётся только через
+// POST /api/register.
+const (
+	RegistrationAuto     = "auto"
+	RegistrationExplicit = "explicit"
+)
+
+// Где хранятся счётчики неудачных входов.
+const (
+	LoginAttemptStoreMemory   = "memory"
+	LoginAttemptStorePostgres = "postgres"
 )
 
 type Config struct {
@@ -14,6 +32,47 @@ type Config struct {
 	DBName    string
 	AppPort   int
 	JWTSecret string
+
+	// JWTKeys — ключи подписи и проверки токенов. Если JWT_SIGNING_KEY_FILE
+	// не задан, токены подписываются HS256 с JWTSecret.
+	JWTKeys *jwtkeys.KeySet
+
+	// CatalogTTL — как долго сервис держит каталог товаров в памяти.
+	CatalogTTL time.Duration
+	// RefundWindow — сколько времени после покупки сотрудник может сам
+	// отменить ещё не выданный заказ.
+	RefundWindow time.Duration
+	// IdempotencyTTL — сколько хранится ответ на запрос с Idempotency-Key.
+	IdempotencyTTL time.Duration
+	// RegistrationMode — RegistrationAuto или RegistrationExplicit.
+	RegistrationMode string
+
+	// LoginAttemptStore — LoginAttemptStoreMemory или LoginAttemptStorePostgres
+	// (нужен, если экземпляров сервиса несколько).
+	LoginAttemptStore string
+	// После LoginLockoutThreshold неудачных входов подряд аккаунт
+	// блокируется на LoginLockoutDuration или до разблокировки админом.
+	LoginLockoutThreshold int
+	LoginLockoutDuration  time.Duration
+
+	// AccessTokenTTL — время жизни JWT; RefreshTokenTTL — refresh-токена,
+	// которым access-токен продлевается.
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// PasswordResetTTL — срок действия токена сброса пароля, выданного админом.
+	PasswordResetTTL time.Duration
+
+	// Вход через OpenID Connect; выключен, если OIDCIssuer пуст.
+	OIDCIssuer       string
+	OIDCClientID     string
+	OIDCClientSecret string
+	// OIDCRedirectURL — адрес /api/auth/oidc/callback этого сервиса,
+	// зарегистрированный у провайдера.
+	OIDCRedirectURL string
+	OIDCScopes      []string
+	// OIDCUsernameClaim — claim ID token с именем пользователя в магазине;
+	// если его нет в токене, используется sub.
+	OIDCUsernameClaim string
 }
 
 func LoadConfig() (*Config, error) {
@@ -26,6 +85,69 @@ func LoadConfig() (*Config, error) {
 		return nil, err
 	}
 
+	catalogTTL, err := time.ParseDuration(getEnv("CATALOG_CACHE_TTL", "1m"))
+	if err != nil {
+		return nil, err
+	}
+
+	refundWindow, err := time.ParseDuration(getEnv("REFUND_WINDOW", "24h"))
+	if err != nil {
+		return nil, err
+	}
+
+	idempotencyTTL, err := time.ParseDuration(getEnv("IDEMPOTENCY_KEY_TTL", "24h"))
+	if err != nil {
+		return nil, err
+	}
+
+	accessTokenTTL, err := time.ParseDuration(getEnv("ACCESS_TOKEN_TTL", "15m"))
+	if err != nil {
+		return nil, err
+	}
+
+	refreshTokenTTL, err := time.ParseDuration(getEnv("REFRESH_TOKEN_TTL", "720h"))
+	if err != nil {
+		return nil, err
+	}
+
+	passwordResetTTL, err := time.ParseDuration(getEnv("PASSWORD_RESET_TTL", "1h"))
+	if err != nil {
+		return nil, err
+	}
+
+	registrationMode := getEnv("REGISTRATION_MODE", RegistrationAuto)
+	if registrationMode != RegistrationAuto && registrationMode != RegistrationExplicit {
+		return nil, fmt.Errorf("REGISTRATION_MODE must be %q or %q", RegistrationAuto, RegistrationExplicit)
+	}
+
+	loginAttemptStore := getEnv("LOGIN_ATTEMPT_STORE", LoginAttemptStoreMemory)
+	if loginAttemptStore != LoginAttemptStoreMemory && loginAttemptStore != LoginAttemptStorePostgres {
+		return nil, fmt.Errorf("LOGIN_ATTEMPT_STORE must be %q or %q", LoginAttemptStoreMemory, LoginAttemptStorePostgres)
+	}
+
+	lockoutThreshold, err := strconv.Atoi(getEnv("LOGIN_LOCKOUT_THRESHOLD", "10"))
+	if err != nil {
+		return nil, err
+	}
+
+	lockoutDuration, err := time.ParseDuration(getEnv("LOGIN_LOCKOUT_DURATION", "1h"))
+	if err != nil {
+		return nil, err
+	}
+
+	jwtSecret := getEnv("JWT_SECRET", "super-secret-key")
+	jwtKeys := jwtkeys.HMAC(jwtSecret)
+	if signingKeyFile := os.Getenv("JWT_SIGNING_KEY_FILE"); signingKeyFile != "" {
+		jwtKeys, err = jwtkeys.Load(signingKeyFile, os.Getenv("JWT_SIGNING_KEY_ID"), splitList(os.Getenv("JWT_VERIFICATION_KEY_FILES")))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if os.Getenv("OIDC_ISSUER") != "" && (os.Getenv("OIDC_CLIENT_ID") == "" || os.Getenv("OIDC_REDIRECT_URL") == "") {
+		return nil, fmt.Errorf("OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required when OIDC_ISSUER is set")
+	}
+
 	cfg := &Config{
 		DBHost:    getEnv("DB_HOST", "localhost"),
 		DBPort:    getEnv("DB_PORT", "5432"),
@@ -33,7 +155,29 @@ func LoadConfig() (*Config, error) {
 		DBPass:    getEnv("DB_PASSWORD", "avito"),
 		DBName:    getEnv("DB_NAME", "avito"),
 		AppPort:   appPort,
-		JWTSecret: getEnv("JWT_SECRET", "super-secret-key"),
+		JWTSecret: jwtSecret,
+		JWTKeys:   jwtKeys,
+
+		CatalogTTL:     catalogTTL,
+		RefundWindow:   refundWindow,
+		IdempotencyTTL: idempotencyTTL,
+
+		RegistrationMode: registrationMode,
+
+		LoginAttemptStore:     loginAttemptStore,
+		LoginLockoutThreshold: lockoutThreshold,
+		LoginLockoutDuration:  lockoutDuration,
+
+		AccessTokenTTL:   accessTokenTTL,
+		RefreshTokenTTL:  refreshTokenTTL,
+		PasswordResetTTL: passwordResetTTL,
+
+		OIDCIssuer:        os.Getenv("OIDC_ISSUER"),
+		OIDCClientID:      os.Getenv("OIDC_CLIENT_ID"),
+		OIDCClientSecret:  os.Getenv("OIDC_CLIENT_SECRET"),
+		OIDCRedirectURL:   os.Getenv("OIDC_REDIRECT_URL"),
+		OIDCScopes:        splitList(getEnv("OIDC_SCOPES", "openid,profile,email")),
+		OIDCUsernameClaim: getEnv("OIDC_USERNAME_CLAIM", "preferred_username"),
 	}
 	return cfg, nil
 }
@@ -49,3 +193,14 @@ func getEnv(key, def string) string {
 	}
 	return val
 }
+
+// splitList разбирает список через запятую, пропуская пустые элементы.
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"avito-shop/internal/models"
+	"avito-shop/internal/service"
+
+	"github.com/gorilla/mux"
+)
+
+// ------------------- /api/admin/items [POST] -------------------
+func (h *Handler) CreateItem(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	adminID := p.UserID
+	var req models.CreateItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	item, err := h.svc.CreateItem(adminID, req)
+	if err != nil {
+		writeAdminItemError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, item)
+}
+
+// ------------------- /api/admin/items/{item} [PUT] -------------------
+func (h *Handler) UpdateItem(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	adminID := p.UserID
+	var req models.UpdateItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	item, err := h.svc.UpdateItem(adminID, mux.Vars(r)["item"], req)
+	if err != nil {
+		writeAdminItemError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, item)
+}
+
+// ------------------- /api/admin/items/{item} [DELETE] -------------------
+func (h *Handler) RetireItem(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	adminID := p.UserID
+	if err := h.svc.RetireItem(adminID, mux.Vars(r)["item"]); err != nil {
+		writeAdminItemError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ------------------- /api/admin/items/{item}/restock [POST] -------------------
+func (h *Handler) RestockItem(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	adminID := p.UserID
+	var req models.RestockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	item, err := h.svc.RestockItem(adminID, mux.Vars(r)["item"], req.Quantity)
+	if err != nil {
+		writeAdminItemError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, item)
+}
+
+// ------------------- /api/admin/items/{item}/stock [PUT] -------------------
+func (h *Handler) SetItemStock(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	adminID := p.UserID
+	var req models.SetStockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	item, err := h.svc.SetItemStock(adminID, mux.Vars(r)["item"], req.Stock)
+	if err != nil {
+		writeAdminItemError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, item)
+}
+
+func writeAdminItemError(w http.ResponseWriter, err error) {
+	switch err {
+	case service.ErrItemNotFound:
+		writeError(w, http.StatusNotFound, err.Error())
+	case service.ErrItemExists:
+		writeError(w, http.StatusConflict, err.Error())
+	case service.ErrInvalidItemName, service.ErrInvalidTitle, service.ErrInvalidPrice,
+		service.ErrInvalidStock, service.ErrInvalidRestock, service.ErrUnlimitedStock:
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
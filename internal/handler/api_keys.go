@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"avito-shop/internal/models"
+	"avito-shop/internal/service"
+
+	"github.com/gorilla/mux"
+)
+
+// ------------------- /api/keys [POST] -------------------
+func (h *Handler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	userID := p.UserID
+
+	var req models.CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	key, err := h.svc.CreateAPIKey(userID, req)
+	if err != nil {
+		switch err {
+		case service.ErrInvalidAPIKeyName, service.ErrInvalidScope, service.ErrInvalidAPIKeyExpiry:
+			writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	writeJSON(w, http.StatusCreated, key)
+}
+
+// ------------------- /api/keys [GET] -------------------
+func (h *Handler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	userID := p.UserID
+
+	keys, err := h.svc.ListAPIKeys(userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, models.APIKeysResponse{Keys: keys})
+}
+
+// ------------------- /api/keys/{id} [DELETE] -------------------
+func (h *Handler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	userID := p.UserID
+	keyID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid key id")
+		return
+	}
+
+	if err := h.svc.RevokeAPIKey(userID, keyID); err != nil {
+		if err == service.ErrAPIKeyNotFound {
+			writeError(w, http.StatusNotFound, err.Error())
+		} else {
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+
+	"avito-shop/internal/models"
+	"avito-shop/internal/service"
+
+	"github.com/gorilla/mux"
+)
+
+// ------------------- /api/register [POST] -------------------
+func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
+	var req models.AuthRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	resp, err := h.svc.Register(req.Username, req.Password)
+	if err != nil {
+		switch err {
+		case service.ErrInvalidUsername, service.ErrWeakPassword:
+			writeError(w, http.StatusBadRequest, err.Error())
+		case service.ErrUsernameTaken:
+			writeError(w, http.StatusConflict, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// ------------------- /api/auth/refresh [POST] -------------------
+func (h *Handler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req models.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	resp, err := h.svc.RefreshTokens(req.RefreshToken)
+	if err != nil {
+		if err == service.ErrInvalidRefreshToken {
+			writeError(w, http.StatusUnauthorized, err.Error())
+		} else {
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// ------------------- /api/auth/logout [POST] -------------------
+// Тело необязательно: без него завершается только текущая сессия.
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.LogoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.svc.Logout(p.UserID, p.SessionID, req.Everywhere); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ------------------- /.well-known/jwks.json [GET] -------------------
+func (h *Handler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	writeJSON(w, http.StatusOK, h.svc.JWKS())
+}
+
+// ------------------- /api/admin/users/{username}/unlock [POST] -------------------
+func (h *Handler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	adminID := p.UserID
+	if err := h.svc.UnlockUser(adminID, mux.Vars(r)["username"]); err != nil {
+		if err == service.ErrUserNotFound {
+			writeError(w, http.StatusNotFound, err.Error())
+		} else {
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ------------------- /api/admin/ips/{ip}/unlock [POST] -------------------
+func (h *Handler) UnlockIP(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	adminID := p.UserID
+	if err := h.svc.UnlockIP(adminID, mux.Vars(r)["ip"]); err != nil {
+		if err == service.ErrInvalidIP {
+			writeError(w, http.StatusBadRequest, err.Error())
+		} else {
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeThrottled: 423 для заблокированного аккаунта, 429 для паузы между
+// попытками; в обоих случаях Retry-After в секундах.
+func writeThrottled(w http.ResponseWriter, err *service.LoginThrottledError) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(err.RetryAfter.Seconds()))))
+	if err.AccountLocked {
+		writeError(w, http.StatusLocked, err.Error())
+	} else {
+		writeError(w, http.StatusTooManyRequests, err.Error())
+	}
+}
+
+// clientIP — адрес клиента из RemoteAddr. Заголовки прокси не учитываются:
+// их может подставить сам клиент.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
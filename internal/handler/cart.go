@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"avito-shop/internal/models"
+	"avito-shop/internal/service"
+
+	"github.com/gorilla/mux"
+)
+
+// ------------------- /api/cart [GET] -------------------
+func (h *Handler) GetCart(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	userID := p.UserID
+	cart, err := h.svc.GetCart(userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, cart)
+}
+
+// ------------------- /api/cart/items [POST] -------------------
+func (h *Handler) AddToCart(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	userID := p.UserID
+	var req models.AddToCartRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.svc.AddToCart(userID, req.Item, req.Quantity); err != nil {
+		switch err {
+		case service.ErrInvalidItem, service.ErrInvalidQuantity:
+			writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// ------------------- /api/cart/items/{item} [DELETE] -------------------
+func (h *Handler) RemoveFromCart(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	userID := p.UserID
+	if err := h.svc.RemoveFromCart(userID, mux.Vars(r)["item"]); err != nil {
+		switch err {
+		case service.ErrCartItemNotFound:
+			writeError(w, http.StatusNotFound, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// ------------------- /api/cart [DELETE] -------------------
+func (h *Handler) ClearCart(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	userID := p.UserID
+	if err := h.svc.ClearCart(userID); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// ------------------- /api/checkout [POST] -------------------
+func (h *Handler) Checkout(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	userID := p.UserID
+	resp, err := h.svc.Checkout(userID)
+	if err != nil {
+		switch err {
+		case service.ErrCartEmpty, service.ErrNotEnoughCoins, service.ErrInvalidItem,
+			service.ErrQuantityTooLarge:
+			writeError(w, http.StatusBadRequest, err.Error())
+		case service.ErrOutOfStock:
+			writeError(w, http.StatusConflict, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
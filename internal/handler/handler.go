@@ -2,6 +2,8 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 
 	"avito-shop/internal/config"
@@ -28,20 +30,52 @@ func (h *Handler) Auth(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := h.svc.AuthUser(req.Username, req.Password)
+	resp, err := h.svc.AuthUser(req.Username, req.Password, clientIP(r))
 	if err != nil {
-		writeError(w, http.StatusUnauthorized, err.Error())
+		var throttled *service.LoginThrottledError
+		if errors.As(err, &throttled) {
+			writeThrottled(w, throttled)
+			return
+		}
+		switch err {
+		case service.ErrUserNotFound:
+			writeError(w, http.StatusNotFound, err.Error())
+		case service.ErrInvalidPassword:
+			writeError(w, http.StatusUnauthorized, err.Error())
+		case service.ErrUsernameTaken:
+			writeError(w, http.StatusConflict, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
 		return
 	}
 
-	resp := models.AuthResponse{Token: token}
 	writeJSON(w, http.StatusOK, resp)
 }
 
 // ------------------- /api/info [GET] -------------------
 func (h *Handler) GetInfo(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value("user_id").(int)
-	info, err := h.svc.GetInfo(userID)
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	userID := p.UserID
+
+	// ?history=aggregated сворачивает историю по второй стороне;
+	// по умолчанию — прежний подробный список.
+	var (
+		info interface{}
+		err  error
+	)
+	switch r.URL.Query().Get("history") {
+	case "", "detailed":
+		info, err = h.svc.GetInfo(userID)
+	case "aggregated":
+		info, err = h.svc.GetInfoAggregated(userID)
+	default:
+		writeError(w, http.StatusBadRequest, "history must be detailed or aggregated")
+		return
+	}
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -50,50 +84,105 @@ func (h *Handler) GetInfo(w http.ResponseWriter, r *http.Request) {
 }
 
 // ------------------- /api/sendCoin [POST] -------------------
+// Поддерживает заголовок Idempotency-Key (см. runIdempotent).
 func (h *Handler) SendCoin(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value("user_id").(int)
-	var req models.SendCoinRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	userID := p.UserID
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
 		writeError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
-
-	if err := h.svc.SendCoin(userID, req.ToUser, req.Amount); err != nil {
-		switch err {
-		case service.ErrNotEnoughCoins:
-			writeError(w, http.StatusBadRequest, err.Error())
-		default:
-			writeError(w, http.StatusBadRequest, err.Error())
-		}
+	var req models.SendCoinRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	h.runIdempotent(w, r, userID, body, func(svc service.Service) error {
+		return svc.SendCoin(userID, req.ToUser, req.Amount, req.Memo)
+	}, sendCoinOutcome)
 }
 
-// ------------------- /api/buy/{item} [GET] -------------------
+func sendCoinOutcome(err error) (int, interface{}, bool) {
+	switch err {
+	case nil:
+		return http.StatusOK, nil, true
+	case service.ErrNotEnoughCoins, service.ErrNegativeAmount, service.ErrEmptyRecipient,
+		service.ErrRecipientNotFound, service.ErrMemoTooLong:
+		return http.StatusBadRequest, models.ErrorResponse{Errors: err.Error()}, true
+	default:
+		return http.StatusBadRequest, models.ErrorResponse{Errors: err.Error()}, false
+	}
+}
+
+// ------------------- /api/buy/{item} [GET, POST] -------------------
+// GET покупает одну штуку; POST принимает {"quantity": N}.
+// Поддерживает заголовок Idempotency-Key (см. runIdempotent).
 func (h *Handler) BuyItem(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value("user_id").(int)
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	userID := p.UserID
 	item := mux.Vars(r)["item"]
 	if item == "" {
 		writeError(w, http.StatusBadRequest, "Item not specified")
 		return
 	}
 
-	if err := h.svc.BuyItem(userID, item); err != nil {
-		switch err {
-		case service.ErrNotEnoughCoins, service.ErrInvalidItem:
-			writeError(w, http.StatusBadRequest, err.Error())
-		default:
-			writeError(w, http.StatusBadRequest, err.Error())
+	var body []byte
+	quantity := 1
+	if r.Method == http.MethodPost {
+		var err error
+		body, err = io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+		var req models.BuyRequest
+		if len(body) > 0 {
+			if err := json.Unmarshal(body, &req); err != nil {
+				writeError(w, http.StatusBadRequest, "Invalid request body")
+				return
+			}
+		}
+		if req.Quantity != nil {
+			quantity = *req.Quantity
 		}
-		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	h.runIdempotent(w, r, userID, body, func(svc service.Service) error {
+		return svc.BuyItem(userID, item, quantity)
+	}, buyItemOutcome)
 }
 
+func buyItemOutcome(err error) (int, interface{}, bool) {
+	switch err {
+	case nil:
+		return http.StatusOK, nil, true
+	case service.ErrNotEnoughCoins, service.ErrInvalidItem,
+		service.ErrInvalidQuantity, service.ErrQuantityTooLarge:
+		return http.StatusBadRequest, models.ErrorResponse{Errors: err.Error()}, true
+	case service.ErrOutOfStock:
+		return http.StatusConflict, models.ErrorResponse{Errors: err.Error()}, true
+	default:
+		return http.StatusBadRequest, models.ErrorResponse{Errors: err.Error()}, false
+	}
+}
 
+// ------------------- /api/items [GET] -------------------
+func (h *Handler) ListItems(w http.ResponseWriter, r *http.Request) {
+	items, err := h.svc.ListItems()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, models.ItemsResponse{Items: items})
+}
 
 func writeError(w http.ResponseWriter, status int, msg string) {
 	w.Header().Set("Content-Type", "application/json")
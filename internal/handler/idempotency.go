@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+
+	"avito-shop/internal/models"
+	"avito-shop/internal/service"
+)
+
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// operation выполняет запрос через svc.
+type operation func(svc service.Service) error
+
+// outcome превращает итог operation (nil — успех) в HTTP-статус и тело
+// ответа (nil — без тела). final = false означает сбой: такой ответ не
+// запоминается, и повтор с тем же ключом выполнит запрос заново.
+type outcome func(err error) (status int, payload interface{}, final bool)
+
+// runIdempotent выполняет op и пишет ответ. Если клиент прислал заголовок
+// Idempotency-Key, ответ сохраняется для пары (пользователь, ключ), а повтор
+// получает сохранённый ответ с заголовком Idempotent-Replayed: true.
+func (h *Handler) runIdempotent(w http.ResponseWriter, r *http.Request, userID int, body []byte, op operation, res outcome) {
+	key := r.Header.Get(idempotencyKeyHeader)
+	if key == "" {
+		status, payload, _ := res(op(h.svc))
+		resp := encodeResult(status, payload)
+		writeRaw(w, resp.StatusCode, resp.Body)
+		return
+	}
+
+	resp, replayed, err := h.svc.Idempotent(userID, key, fingerprint(r, body), op, func(opErr error) (models.IdempotentResponse, bool) {
+		status, payload, final := res(opErr)
+		return encodeResult(status, payload), final
+	})
+	if err != nil {
+		switch err {
+		case service.ErrInvalidIdempotencyKey:
+			writeError(w, http.StatusBadRequest, err.Error())
+		case service.ErrIdempotencyKeyReused:
+			writeError(w, http.StatusUnprocessableEntity, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	if replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
+	}
+	writeRaw(w, resp.StatusCode, resp.Body)
+}
+
+// fingerprint отличает разные запросы, отправленные с одним ключом.
+func fingerprint(r *http.Request, body []byte) string {
+	sum := sha256.New()
+	sum.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	sum.Write(body)
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+func encodeResult(status int, payload interface{}) models.IdempotentResponse {
+	resp := models.IdempotentResponse{StatusCode: status}
+	if payload != nil {
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return models.IdempotentResponse{StatusCode: http.StatusInternalServerError}
+		}
+		resp.Body = body
+	}
+	return resp
+}
+
+func writeRaw(w http.ResponseWriter, status int, body []byte) {
+	if len(body) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"avito-shop/internal/models"
+	"avito-shop/internal/service"
+)
+
+// ------------------- /api/auth/mfa [POST] -------------------
+func (h *Handler) VerifyMFA(w http.ResponseWriter, r *http.Request) {
+	var req models.MFAVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	resp, err := h.svc.VerifyMFA(req.MFAToken, req.Code, clientIP(r))
+	if err != nil {
+		var throttled *service.LoginThrottledError
+		if errors.As(err, &throttled) {
+			writeThrottled(w, throttled)
+			return
+		}
+		switch err {
+		case service.ErrInvalidMFAToken, service.ErrInvalidMFACode:
+			writeError(w, http.StatusUnauthorized, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// ------------------- /api/me/2fa/enroll [POST] -------------------
+func (h *Handler) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	userID := p.UserID
+
+	resp, err := h.svc.EnrollTOTP(userID)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// ------------------- /api/me/2fa/confirm [POST] -------------------
+func (h *Handler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	userID := p.UserID
+
+	var req models.MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	resp, err := h.svc.ConfirmTOTP(userID, req.Code)
+	if err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// ------------------- /api/me/2fa/disable [POST] -------------------
+func (h *Handler) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	userID := p.UserID
+
+	var req models.MFACodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.svc.DisableTOTP(userID, req.Code); err != nil {
+		writeMFAError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeMFAError — ошибки настройки 2FA. Неверный код здесь 400, а не 401:
+// сам пользователь аутентифицирован.
+func writeMFAError(w http.ResponseWriter, err error) {
+	switch err {
+	case service.ErrInvalidMFACode:
+		writeError(w, http.StatusBadRequest, err.Error())
+	case service.ErrMFAAlreadyEnabled, service.ErrMFANotEnrolled, service.ErrMFANotEnabled:
+		writeError(w, http.StatusConflict, err.Error())
+	case service.ErrUserNotFound:
+		writeError(w, http.StatusNotFound, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
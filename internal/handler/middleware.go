@@ -4,10 +4,42 @@ import (
 	"context"
 	"net/http"
 	"strings"
-	"github.com/golang-jwt/jwt/v4"
+
+	"avito-shop/internal/models"
+	"avito-shop/internal/service"
 )
 
-func JwtMiddleware(secret string) func(http.Handler) http.Handler {
+// principalKey — ключ контекста для *models.Principal. Неэкспортируемый
+// тип не пересечётся с ключами других пакетов.
+type principalKey struct{}
+
+func withPrincipal(ctx context.Context, p *models.Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext возвращает того, кто выполняет запрос, если его
+// положил JwtMiddleware.
+func PrincipalFromContext(ctx context.Context) (*models.Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*models.Principal)
+	return p, ok && p != nil
+}
+
+// principal — PrincipalFromContext для хендлеров: без него отвечает 401,
+// и хендлер должен просто вернуться.
+func principal(w http.ResponseWriter, r *http.Request) (*models.Principal, bool) {
+	p, ok := PrincipalFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Authentication required")
+	}
+	return p, ok
+}
+
+// JwtMiddleware проверяет подпись и срок access-токена ключами сервиса
+// (по kid из заголовка), а затем через svc.CheckSession — что его сессия
+// не отозвана logout'ом. Вместо JWT можно передать API-ключ (Bearer ask_...).
+// В контекст кладётся *models.Principal; права на конкретный маршрут
+// проверяют RequireScope и RequireRole.
+func JwtMiddleware(svc service.Service) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			authHeader := r.Header.Get("Authorization")
@@ -22,24 +54,78 @@ func JwtMiddleware(secret string) func(http.Handler) http.Handler {
 				return
 			}
 
-			tokenString := parts[1]
-			claims := jwt.MapClaims{}
-			token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
-				return []byte(secret), nil
-			})
-			if err != nil || !token.Valid {
+			if strings.HasPrefix(parts[1], service.APIKeyPrefix) {
+				p, err := svc.AuthenticateAPIKey(parts[1])
+				if err != nil {
+					if err == service.ErrInvalidAPIKey {
+						writeError(w, http.StatusUnauthorized, "Invalid API key")
+					} else {
+						writeError(w, http.StatusInternalServerError, err.Error())
+					}
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(withPrincipal(r.Context(), p)))
+				return
+			}
+
+			claims, err := svc.ParseAccessToken(parts[1])
+			if err != nil {
 				writeError(w, http.StatusUnauthorized, "Invalid token")
 				return
 			}
+			if err := svc.CheckSession(claims.UserID, claims.SessionID, claims.TokenVersion); err != nil {
+				if err == service.ErrSessionRevoked {
+					writeError(w, http.StatusUnauthorized, "Token has been revoked")
+				} else {
+					writeError(w, http.StatusInternalServerError, err.Error())
+				}
+				return
+			}
+			p := &models.Principal{
+				UserID:    claims.UserID,
+				Username:  claims.Username,
+				Roles:     []string{claims.Role},
+				Scopes:    claims.Scopes,
+				TokenID:   claims.TokenID,
+				SessionID: claims.SessionID,
+			}
+			next.ServeHTTP(w, r.WithContext(withPrincipal(r.Context(), p)))
+		})
+	}
+}
+
+// RequireScope пропускает запрос, только если у principal есть scope.
+// Должен стоять после JwtMiddleware.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := principal(w, r)
+			if !ok {
+				return
+			}
+			if !p.HasScope(scope) {
+				writeError(w, http.StatusForbidden, "Scope "+scope+" required")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
 
-			// Извлекаем user_id
-			userID, ok := claims["user_id"].(float64)
+// RequireRole пропускает запрос, только если у principal есть role.
+// Должен стоять после JwtMiddleware.
+func RequireRole(role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := principal(w, r)
 			if !ok {
-				writeError(w, http.StatusUnauthorized, "Invalid user_id in token")
 				return
 			}
-			ctx := context.WithValue(r.Context(), "user_id", int(userID))
-			next.ServeHTTP(w, r.WithContext(ctx))
+			if !p.HasRole(role) {
+				writeError(w, http.StatusForbidden, "Role "+role+" required")
+				return
+			}
+			next.ServeHTTP(w, r)
 		})
 	}
 }
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"avito-shop/internal/config"
+	"avito-shop/internal/models"
+	"avito-shop/internal/service"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubService отвечает только на AuthenticateAPIKey; любой другой вызов
+// упадёт на nil-интерфейсе, так что тест заметит лишнее обращение к сервису.
+type stubService struct {
+	service.Service
+	key *models.Principal
+}
+
+func (s *stubService) AuthenticateAPIKey(secret string) (*models.Principal, error) {
+	if s.key == nil {
+		return nil, service.ErrInvalidAPIKey
+	}
+	return s.key, nil
+}
+
+// ok — хендлер, до которого запрос доходит, только если пропустили middleware.
+var ok = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+})
+
+// newTestRouter собирает подроутеры account и admin так же, как cmd/app.
+func newTestRouter(svc service.Service) *mux.Router {
+	r := mux.NewRouter()
+	apiRouter := r.PathPrefix("/api").Subrouter()
+	apiRouter.Use(JwtMiddleware(svc))
+
+	accountRouter := apiRouter.NewRoute().Subrouter()
+	accountRouter.Use(RequireScope(models.ScopeAccount))
+	accountRouter.Handle("/keys", ok).Methods("GET", "POST")
+	accountRouter.Handle("/auth/oidc/link", ok).Methods("POST")
+
+	adminRouter := apiRouter.PathPrefix("/admin").Subrouter()
+	adminRouter.Use(RequireRole(models.RoleAdmin), RequireScope(models.ScopeAdmin))
+	adminRouter.Handle("/items", ok).Methods("POST")
+	adminRouter.Handle("/users/{username}/unlock", ok).Methods("POST")
+	return r
+}
+
+func serve(h http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestPrincipal_Missing(t *testing.T) {
+	h := NewHandler(&stubService{}, &config.Config{})
+
+	rec := serve(http.HandlerFunc(h.GetInfo), httptest.NewRequest("GET", "/api/info", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = serve(RequireScope(models.ScopeInfoRead)(ok), httptest.NewRequest("GET", "/api/info", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = serve(RequireRole(models.RoleAdmin)(ok), httptest.NewRequest("POST", "/api/admin/items", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestRequireScope(t *testing.T) {
+	p := &models.Principal{UserID: 1, Username: "alice", Roles: []string{models.RoleEmployee},
+		Scopes: []string{models.ScopeInfoRead}}
+
+	req := httptest.NewRequest("POST", "/api/sendCoin", nil)
+	req = req.WithContext(withPrincipal(req.Context(), p))
+	rec := serve(RequireScope(models.ScopeCoinsSend)(ok), req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	req = httptest.NewRequest("GET", "/api/info", nil)
+	req = req.WithContext(withPrincipal(req.Context(), p))
+	rec = serve(RequireScope(models.ScopeInfoRead)(ok), req)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
+
+func TestRequireRole(t *testing.T) {
+	p := &models.Principal{UserID: 1, Username: "alice", Roles: []string{models.RoleEmployee},
+		Scopes: []string{models.ScopeAdmin}}
+
+	req := httptest.NewRequest("POST", "/api/admin/items", nil)
+	req = req.WithContext(withPrincipal(req.Context(), p))
+	rec := serve(RequireRole(models.RoleAdmin)(ok), req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestAPIKey_AccountAndAdminRoutesForbidden(t *testing.T) {
+	// Ключ администратора со всеми областями, какие вообще можно выдать ключу:
+	// роль admin у него есть, но ни admin, ни account — нет.
+	svc := &stubService{key: &models.Principal{
+		UserID:   1,
+		Username: "admin",
+		Roles:    []string{models.RoleAdmin},
+		Scopes:   []string{models.ScopeInfoRead, models.ScopeCoinsSend, models.ScopeItemsBuy},
+		TokenID:  "apikey:7",
+		APIKeyID: 7,
+	}}
+	r := newTestRouter(svc)
+
+	for _, tc := range []struct{ method, path string }{
+		{"GET", "/api/keys"},
+		{"POST", "/api/keys"},
+		{"POST", "/api/auth/oidc/link"},
+		{"POST", "/api/admin/items"},
+		{"POST", "/api/admin/users/bob/unlock"},
+	} {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		req.Header.Set("Authorization", "Bearer "+service.APIKeyPrefix+"secret")
+		rec := serve(r, req)
+		assert.Equal(t, http.StatusForbidden, rec.Code, "%s %s", tc.method, tc.path)
+	}
+
+	// Без заголовка до RequireScope дело не доходит.
+	rec := serve(r, httptest.NewRequest("GET", "/api/keys", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
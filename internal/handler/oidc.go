@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"avito-shop/internal/models"
+	"avito-shop/internal/service"
+)
+
+const (
+	oidcStateCookie = "oidc_state"
+	oidcCookiePath  = "/api/auth/oidc"
+)
+
+// ------------------- /api/auth/oidc/login [GET] -------------------
+// Перенаправляет браузер к провайдеру; состояние входа — в cookie.
+func (h *Handler) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	start, err := h.svc.StartOIDCLogin()
+	if err != nil {
+		writeOIDCError(w, err)
+		return
+	}
+	setOIDCStateCookie(w, r, start)
+	http.Redirect(w, r, start.AuthURL, http.StatusFound)
+}
+
+// ------------------- /api/auth/oidc/link [POST] -------------------
+// Привязка учётной записи провайдера к текущему пользователю. Запрос
+// приходит с Bearer-токеном, поэтому вместо редиректа отдаётся authUrl;
+// клиент открывает его сам, и вход завершается тем же callback.
+func (h *Handler) OIDCLink(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	start, err := h.svc.StartOIDCLink(p.UserID)
+	if err != nil {
+		writeOIDCError(w, err)
+		return
+	}
+	setOIDCStateCookie(w, r, start)
+	writeJSON(w, http.StatusOK, models.OIDCLinkResponse{AuthURL: start.AuthURL})
+}
+
+func setOIDCStateCookie(w http.ResponseWriter, r *http.Request, start *models.OIDCLoginStart) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    start.StateToken,
+		Path:     oidcCookiePath,
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		// Lax: cookie должна прийти с редиректом от провайдера.
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// ------------------- /api/auth/oidc/callback [GET] -------------------
+func (h *Handler) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		writeError(w, http.StatusUnauthorized, "oidc login failed: "+e)
+		return
+	}
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, service.ErrInvalidOIDCState.Error())
+		return
+	}
+	// Состояние одноразовое.
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: oidcCookiePath, MaxAge: -1, HttpOnly: true})
+
+	resp, err := h.svc.FinishOIDCLogin(cookie.Value, q.Get("state"), q.Get("code"))
+	if err != nil {
+		writeOIDCError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func writeOIDCError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrOIDCDisabled):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrInvalidOIDCState):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrOIDCLoginFailed):
+		writeError(w, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, service.ErrOIDCAccountExists), errors.Is(err, service.ErrOIDCIdentityLinked):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, service.ErrOIDCProviderUnavailable):
+		writeError(w, http.StatusBadGateway, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"avito-shop/internal/models"
+	"avito-shop/internal/service"
+
+	"github.com/gorilla/mux"
+)
+
+// ------------------- /api/orders [GET] -------------------
+func (h *Handler) ListOrders(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	userID := p.UserID
+	orders, err := h.svc.ListOrders(userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, models.OrdersResponse{Orders: orders})
+}
+
+// ------------------- /api/admin/orders [GET] -------------------
+func (h *Handler) AdminListOrders(w http.ResponseWriter, r *http.Request) {
+	orders, err := h.svc.AdminListOrders(r.URL.Query().Get("status"))
+	if err != nil {
+		writeOrderError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, models.OrdersResponse{Orders: orders})
+}
+
+// ------------------- /api/admin/orders/{id}/status [PUT] -------------------
+func (h *Handler) SetOrderStatus(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	adminID := p.UserID
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid order id")
+		return
+	}
+	var req models.OrderStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	order, err := h.svc.SetOrderStatus(adminID, orderID, req.Status)
+	if err != nil {
+		writeOrderError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, order)
+}
+
+// ------------------- /api/orders/{id}/cancel [POST] -------------------
+func (h *Handler) CancelOrder(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	userID := p.UserID
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid order id")
+		return
+	}
+
+	order, err := h.svc.CancelOrder(userID, orderID)
+	if err != nil {
+		writeOrderError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, order)
+}
+
+func writeOrderError(w http.ResponseWriter, err error) {
+	switch err {
+	case service.ErrOrderNotFound:
+		writeError(w, http.StatusNotFound, err.Error())
+	case service.ErrInvalidOrderStatus:
+		writeError(w, http.StatusBadRequest, err.Error())
+	case service.ErrOrderTransition, service.ErrOrderNotCancelable, service.ErrRefundWindowClosed:
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"avito-shop/internal/models"
+	"avito-shop/internal/service"
+
+	"github.com/gorilla/mux"
+)
+
+// ------------------- /api/me/password [POST] -------------------
+func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	userID := p.UserID
+
+	var req models.ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	resp, err := h.svc.ChangePassword(userID, req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		var throttled *service.LoginThrottledError
+		if errors.As(err, &throttled) {
+			writeThrottled(w, throttled)
+			return
+		}
+		switch err {
+		case service.ErrInvalidPassword:
+			writeError(w, http.StatusForbidden, err.Error())
+		case service.ErrWeakPassword:
+			writeError(w, http.StatusBadRequest, err.Error())
+		case service.ErrUserNotFound:
+			writeError(w, http.StatusNotFound, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// ------------------- /api/admin/users/{username}/password-reset [POST] -------------------
+func (h *Handler) CreatePasswordReset(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	adminID := p.UserID
+
+	resp, err := h.svc.CreatePasswordReset(adminID, mux.Vars(r)["username"])
+	if err != nil {
+		if err == service.ErrUserNotFound {
+			writeError(w, http.StatusNotFound, err.Error())
+		} else {
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// ------------------- /api/auth/password-reset [POST] -------------------
+func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req models.ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.svc.ResetPassword(req.ResetToken, req.NewPassword); err != nil {
+		switch err {
+		case service.ErrInvalidResetToken:
+			writeError(w, http.StatusUnauthorized, err.Error())
+		case service.ErrWeakPassword:
+			writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
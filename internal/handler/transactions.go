@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"avito-shop/internal/models"
+	"avito-shop/internal/service"
+)
+
+// ------------------- /api/transactions [GET] -------------------
+func (h *Handler) ListTransactions(w http.ResponseWriter, r *http.Request) {
+	p, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	userID := p.UserID
+	params := r.URL.Query()
+
+	q := models.TransactionQuery{
+		Direction:    params.Get("direction"),
+		Counterparty: params.Get("counterparty"),
+		Kind:         params.Get("kind"),
+		Cursor:       params.Get("cursor"),
+	}
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		q.Limit = limit
+	}
+	var err error
+	if q.From, err = parseTimeParam(params.Get("from"), false); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid from")
+		return
+	}
+	if q.To, err = parseTimeParam(params.Get("to"), true); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid to")
+		return
+	}
+
+	resp, err := h.svc.ListTransactions(userID, q)
+	if err != nil {
+		switch err {
+		case service.ErrInvalidDirection, service.ErrInvalidKind, service.ErrInvalidCursor,
+			service.ErrInvalidDateRange, service.ErrCounterpartyNotFound, service.ErrInvalidTransactionLimit:
+			writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// parseTimeParam принимает RFC3339 или дату YYYY-MM-DD. Дата в верхней
+// границе означает «включая весь этот день».
+func parseTimeParam(v string, upper bool) (*time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return nil, err
+	}
+	if upper {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
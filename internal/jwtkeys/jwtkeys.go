@@ -0,0 +1,258 @@
+// Package jwtkeys хранит ключи, которыми подписываются и проверяются JWT
+// сервиса, и отдаёт публичную часть в формате JWKS.
+package jwtkeys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	ErrUnknownKeyID       = errors.New("unknown key id")
+	ErrUnexpectedMethod   = errors.New("unexpected signing method")
+	ErrUnsupportedKeyType = errors.New("unsupported key type: only RSA and Ed25519 are supported")
+	ErrNoSigningKey       = errors.New("key set has no signing key")
+)
+
+// key — один ключ набора. private есть только у ключа подписи.
+type key struct {
+	id      string
+	method  jwt.SigningMethod
+	private crypto.PrivateKey
+	public  crypto.PublicKey
+}
+
+// KeySet — ключ подписи и все ключи, которыми ещё принимаются токены.
+// При ротации новый ключ становится ключом подписи, а старый остаётся в
+// списке проверки, пока не истекут выпущенные им токены.
+type KeySet struct {
+	signing *key
+	verify  map[string]*key
+	// hmac — режим совместимости: HS256 с общим секретом, без kid и JWKS.
+	hmac []byte
+}
+
+// HMAC возвращает набор, который подписывает и проверяет токены HS256
+// общим секретом.
+func HMAC(secret string) *KeySet {
+	return &KeySet{hmac: []byte(secret)}
+}
+
+// Load читает ключ подписи (PEM, PKCS#8 или PKCS#1) и дополнительные
+// ключи проверки (PEM с публичным или приватным ключом). kid — имя файла
+// до первой точки; для ключа подписи его можно задать явно signingKeyID.
+func Load(signingKeyFile, signingKeyID string, verificationKeyFiles []string) (*KeySet, error) {
+	signing, err := loadKey(signingKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if signing.private == nil {
+		return nil, fmt.Errorf("%s: signing key must be a private key", signingKeyFile)
+	}
+	if signingKeyID != "" {
+		signing.id = signingKeyID
+	}
+
+	ks := &KeySet{signing: signing, verify: map[string]*key{signing.id: signing}}
+	for _, path := range verificationKeyFiles {
+		k, err := loadKey(path)
+		if err != nil {
+			return nil, err
+		}
+		if _, dup := ks.verify[k.id]; dup {
+			return nil, fmt.Errorf("%s: duplicate key id %q", path, k.id)
+		}
+		ks.verify[k.id] = k
+	}
+	return ks, nil
+}
+
+// Sign подписывает claims текущим ключом подписи и ставит его kid в
+// заголовок.
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	if ks.verify == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(ks.hmac)
+	}
+	if ks.signing == nil {
+		return "", ErrNoSigningKey
+	}
+	token := jwt.NewWithClaims(ks.signing.method, claims)
+	token.Header["kid"] = ks.signing.id
+	return token.SignedString(ks.signing.private)
+}
+
+// Parse проверяет подпись токена ключом из набора по kid. Алгоритм
+// должен совпадать с типом ключа, иначе токен отклоняется.
+func (ks *KeySet) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		if ks.verify == nil {
+			if t.Method != jwt.SigningMethodHS256 {
+				return nil, ErrUnexpectedMethod
+			}
+			return ks.hmac, nil
+		}
+		kid, _ := t.Header["kid"].(string)
+		k, ok := ks.verify[kid]
+		if !ok {
+			return nil, ErrUnknownKeyID
+		}
+		if t.Method.Alg() != k.method.Alg() {
+			return nil, ErrUnexpectedMethod
+		}
+		return k.public, nil
+	})
+}
+
+// FromJWKS строит набор только для проверки — например, из JWKS внешнего
+// провайдера. Ключи без kid и неподдерживаемых типов пропускаются.
+func FromJWKS(set JWKS) (*KeySet, error) {
+	ks := &KeySet{verify: make(map[string]*key, len(set.Keys))}
+	for _, jwk := range set.Keys {
+		if jwk.Kid == "" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		k := &key{id: jwk.Kid}
+		switch {
+		case jwk.Kty == "RSA":
+			n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %w", jwk.Kid, err)
+			}
+			e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %w", jwk.Kid, err)
+			}
+			k.public = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+			k.method = jwt.SigningMethodRS256
+		case jwk.Kty == "OKP" && jwk.Crv == "Ed25519":
+			x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+			if err != nil || len(x) != ed25519.PublicKeySize {
+				return nil, fmt.Errorf("key %q: invalid Ed25519 public key", jwk.Kid)
+			}
+			k.public = ed25519.PublicKey(x)
+			k.method = jwt.SigningMethodEdDSA
+		default:
+			continue
+		}
+		if jwk.Alg != "" && jwk.Alg != k.method.Alg() {
+			continue
+		}
+		ks.verify[k.id] = k
+	}
+	if len(ks.verify) == 0 {
+		return nil, ErrUnsupportedKeyType
+	}
+	return ks, nil
+}
+
+// JWK — публичный ключ в формате RFC 7517.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS возвращает публичные ключи проверки, отсортированные по kid. В
+// режиме HMAC список пуст: общий секрет не публикуется.
+func (ks *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: make([]JWK, 0, len(ks.verify))}
+	for _, k := range ks.verify {
+		jwk := JWK{Kid: k.id, Use: "sig", Alg: k.method.Alg()}
+		switch pub := k.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = b64(pub.N.Bytes())
+			jwk.E = b64(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = b64(pub)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool {
+		return set.Keys[i].Kid < set.Keys[j].Kid
+	})
+	return set
+}
+
+func loadKey(path string) (*key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", path)
+	}
+
+	k := &key{id: keyIDFromPath(path)}
+	switch block.Type {
+	case "PUBLIC KEY":
+		k.public, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		k.private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		k.private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	switch priv := k.private.(type) {
+	case *rsa.PrivateKey:
+		k.public = &priv.PublicKey
+	case ed25519.PrivateKey:
+		k.public = priv.Public()
+	case nil:
+	default:
+		return nil, fmt.Errorf("%s: %w", path, ErrUnsupportedKeyType)
+	}
+
+	switch k.public.(type) {
+	case *rsa.PublicKey:
+		k.method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		k.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("%s: %w", path, ErrUnsupportedKeyType)
+	}
+	return k, nil
+}
+
+// keyIDFromPath: /keys/2024-06.pub.pem -> 2024-06.
+func keyIDFromPath(path string) string {
+	name := filepath.Base(path)
+	if i := strings.Index(name, "."); i > 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,258 @@
+package jwtkeys_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"avito-shop/internal/jwtkeys"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeKey сохраняет приватный ключ в PKCS#8 PEM и возвращает путь.
+func writeKey(t *testing.T, dir, name string, priv interface{}) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	require.NoError(t, err)
+	return writePEM(t, dir, name, "PRIVATE KEY", der)
+}
+
+// writePublicKey сохраняет публичный ключ в PKIX PEM и возвращает путь.
+func writePublicKey(t *testing.T, dir, name string, pub interface{}) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	require.NoError(t, err)
+	return writePEM(t, dir, name, "PUBLIC KEY", der)
+}
+
+func writePEM(t *testing.T, dir, name, typ string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600))
+	return path
+}
+
+func testClaims() jwt.MapClaims {
+	return jwt.MapClaims{"user_id": 1, "exp": time.Now().Add(time.Minute).Unix()}
+}
+
+// header возвращает alg и kid токена без проверки подписи.
+func header(t *testing.T, token string) (string, string) {
+	t.Helper()
+	parsed, _, err := new(jwt.Parser).ParseUnverified(token, jwt.MapClaims{})
+	require.NoError(t, err)
+	kid, _ := parsed.Header["kid"].(string)
+	return parsed.Method.Alg(), kid
+}
+
+func TestLoad_EdDSA(t *testing.T) {
+	dir := t.TempDir()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	keys, err := jwtkeys.Load(writeKey(t, dir, "2024-06.pem", priv), "", nil)
+	require.NoError(t, err)
+
+	token, err := keys.Sign(testClaims())
+	require.NoError(t, err)
+	alg, kid := header(t, token)
+	assert.Equal(t, "EdDSA", alg)
+	assert.Equal(t, "2024-06", kid)
+
+	claims := jwt.MapClaims{}
+	parsed, err := keys.Parse(token, claims)
+	require.NoError(t, err)
+	assert.True(t, parsed.Valid)
+	assert.Equal(t, float64(1), claims["user_id"])
+
+	set := keys.JWKS()
+	require.Len(t, set.Keys, 1)
+	assert.Equal(t, "OKP", set.Keys[0].Kty)
+	assert.Equal(t, "Ed25519", set.Keys[0].Crv)
+	assert.Equal(t, "2024-06", set.Keys[0].Kid)
+	assert.Equal(t, "sig", set.Keys[0].Use)
+	assert.Equal(t, "EdDSA", set.Keys[0].Alg)
+	assert.NotEmpty(t, set.Keys[0].X)
+}
+
+func TestLoad_KeyFormats(t *testing.T) {
+	dir := t.TempDir()
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	// PKCS#1 и явный kid.
+	pkcs1 := writePEM(t, dir, "legacy.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(priv))
+	keys, err := jwtkeys.Load(pkcs1, "main", nil)
+	require.NoError(t, err)
+	token, err := keys.Sign(testClaims())
+	require.NoError(t, err)
+	alg, kid := header(t, token)
+	assert.Equal(t, "RS256", alg)
+	assert.Equal(t, "main", kid)
+
+	// Публичным ключом подписывать нельзя.
+	pub := writePublicKey(t, dir, "main.pub.pem", &priv.PublicKey)
+	_, err = jwtkeys.Load(pub, "", nil)
+	assert.Error(t, err)
+
+	// kid ключей проверки не должны повторяться.
+	_, err = jwtkeys.Load(writeKey(t, dir, "main.pem", priv), "", []string{pub})
+	assert.Error(t, err)
+
+	_, err = jwtkeys.Load(filepath.Join(dir, "missing.pem"), "", nil)
+	assert.Error(t, err)
+}
+
+func TestKeySet_Rotation(t *testing.T) {
+	dir := t.TempDir()
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	oldKeys, err := jwtkeys.Load(writeKey(t, dir, "old.pem", oldKey), "", nil)
+	require.NoError(t, err)
+	oldToken, err := oldKeys.Sign(testClaims())
+	require.NoError(t, err)
+
+	// Подписываем новым ключом, старый остаётся только для проверки.
+	keys, err := jwtkeys.Load(writeKey(t, dir, "new.pem", newKey), "",
+		[]string{writePublicKey(t, dir, "old.pub.pem", &oldKey.PublicKey)})
+	require.NoError(t, err)
+
+	newToken, err := keys.Sign(testClaims())
+	require.NoError(t, err)
+	alg, kid := header(t, newToken)
+	assert.Equal(t, "RS256", alg)
+	assert.Equal(t, "new", kid)
+
+	_, err = keys.Parse(newToken, jwt.MapClaims{})
+	assert.NoError(t, err)
+	_, err = keys.Parse(oldToken, jwt.MapClaims{})
+	assert.NoError(t, err)
+
+	set := keys.JWKS()
+	require.Len(t, set.Keys, 2)
+	assert.Equal(t, []string{"new", "old"}, []string{set.Keys[0].Kid, set.Keys[1].Kid})
+	assert.Equal(t, "RSA", set.Keys[0].Kty)
+	assert.Equal(t, "AQAB", set.Keys[0].E)
+
+	// После удаления старого ключа его токены больше не принимаются.
+	keys, err = jwtkeys.Load(filepath.Join(dir, "new.pem"), "", nil)
+	require.NoError(t, err)
+	_, err = keys.Parse(oldToken, jwt.MapClaims{})
+	assert.ErrorIs(t, err, jwtkeys.ErrUnknownKeyID)
+}
+
+func TestKeySet_RejectsForeignTokens(t *testing.T) {
+	dir := t.TempDir()
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keys, err := jwtkeys.Load(writeKey(t, dir, "main.pem", priv), "", nil)
+	require.NoError(t, err)
+
+	// HS256 с известным kid: нельзя подписать токен публичным ключом как секретом.
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+	forged.Header["kid"] = "main"
+	der, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	require.NoError(t, err)
+	signed, err := forged.SignedString(der)
+	require.NoError(t, err)
+	_, err = keys.Parse(signed, jwt.MapClaims{})
+	assert.ErrorIs(t, err, jwtkeys.ErrUnexpectedMethod)
+
+	// Неизвестный kid
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherKeys, err := jwtkeys.Load(writeKey(t, dir, "other.pem", other), "", nil)
+	require.NoError(t, err)
+	token, err := otherKeys.Sign(testClaims())
+	require.NoError(t, err)
+	_, err = keys.Parse(token, jwt.MapClaims{})
+	assert.ErrorIs(t, err, jwtkeys.ErrUnknownKeyID)
+
+	// Токен HS256 из режима совместимости
+	token, err = jwtkeys.HMAC("super-secret-key").Sign(testClaims())
+	require.NoError(t, err)
+	_, err = keys.Parse(token, jwt.MapClaims{})
+	assert.Error(t, err)
+}
+
+func TestHMAC(t *testing.T) {
+	keys := jwtkeys.HMAC("super-secret-key")
+
+	token, err := keys.Sign(testClaims())
+	require.NoError(t, err)
+	alg, kid := header(t, token)
+	assert.Equal(t, "HS256", alg)
+	assert.Empty(t, kid)
+	_, err = keys.Parse(token, jwt.MapClaims{})
+	assert.NoError(t, err)
+
+	// Другой секрет
+	_, err = jwtkeys.HMAC("other-secret").Parse(token, jwt.MapClaims{})
+	assert.Error(t, err)
+
+	// Общий секрет не публикуется.
+	assert.Empty(t, keys.JWKS().Keys)
+
+	// Асимметричный токен в режиме HMAC не принимается.
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	edKeys, err := jwtkeys.Load(writeKey(t, t.TempDir(), "ed.pem", priv), "", nil)
+	require.NoError(t, err)
+	token, err = edKeys.Sign(testClaims())
+	require.NoError(t, err)
+	_, err = keys.Parse(token, jwt.MapClaims{})
+	assert.ErrorIs(t, err, jwtkeys.ErrUnexpectedMethod)
+}
+
+func TestFromJWKS_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	rsaKeys, err := jwtkeys.Load(writeKey(t, dir, "rsa.pem", rsaKey), "", nil)
+	require.NoError(t, err)
+	edKeys, err := jwtkeys.Load(writeKey(t, dir, "ed.pem", edKey), "",
+		[]string{writePublicKey(t, dir, "rsa.pub.pem", &rsaKey.PublicKey)})
+	require.NoError(t, err)
+
+	// Опубликованный JWKS восстанавливается в набор для проверки.
+	set := edKeys.JWKS()
+	set.Keys = append(set.Keys,
+		jwtkeys.JWK{Kty: "RSA", Kid: "enc", Use: "enc", N: set.Keys[1].N, E: set.Keys[1].E},
+		jwtkeys.JWK{Kty: "RSA", Use: "sig", N: set.Keys[1].N, E: set.Keys[1].E},
+		jwtkeys.JWK{Kty: "EC", Kid: "ec", Crv: "P-256"},
+		jwtkeys.JWK{Kty: "OKP", Kid: "wrong-alg", Crv: "Ed25519", Alg: "RS256", X: set.Keys[0].X},
+	)
+	verify, err := jwtkeys.FromJWKS(set)
+	require.NoError(t, err)
+	assert.Equal(t, edKeys.JWKS(), verify.JWKS())
+
+	for _, signer := range []*jwtkeys.KeySet{rsaKeys, edKeys} {
+		token, err := signer.Sign(testClaims())
+		require.NoError(t, err)
+		_, err = verify.Parse(token, jwt.MapClaims{})
+		assert.NoError(t, err)
+	}
+
+	// Набор из JWKS только проверяет.
+	_, err = verify.Sign(testClaims())
+	assert.ErrorIs(t, err, jwtkeys.ErrNoSigningKey)
+
+	_, err = jwtkeys.FromJWKS(jwtkeys.JWKS{Keys: []jwtkeys.JWK{{Kty: "EC", Kid: "ec"}}})
+	assert.ErrorIs(t, err, jwtkeys.ErrUnsupportedKeyType)
+	_, err = jwtkeys.FromJWKS(jwtkeys.JWKS{Keys: []jwtkeys.JWK{{Kty: "OKP", Kid: "bad", Crv: "Ed25519", X: "AAAA"}}})
+	assert.Error(t, err)
+}
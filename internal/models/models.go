@@ -7,14 +7,87 @@ type User struct {
 	Username string `db:"username"`
 	Password string `db:"password"`
 	Coins    int    `db:"coins"`
+	Role     string `db:"role"`
 }
 
+const (
+	RoleEmployee = "employee"
+	RoleAdmin    = "admin"
+)
+
 type CoinTransaction struct {
 	ID         int       `db:"id"`
 	FromUserID *int      `db:"from_user_id"` 
 	ToUserID   *int      `db:"to_user_id"`   
 	Amount     int       `db:"amount"`
+	Kind       string    `db:"kind"`
+	OrderID    *int      `db:"order_id"`
+	Memo       string    `db:"memo"`
 	CreatedAt  time.Time `db:"created_at"`
+
+	// Заполняются запросами, которые джойнят users.
+	FromUsername *string `db:"from_username"`
+	ToUsername   *string `db:"to_username"`
+}
+
+// Типы записей в coin_transactions.
+const (
+	TxTransfer   = "transfer"
+	TxPurchase   = "purchase"
+	TxRefund     = "refund"
+	TxGrant      = "grant"
+	TxAdjustment = "adjustment"
+	TxExpiry     = "expiry"
+)
+
+// LedgerPosting — одна сторона двойной записи. Ровно одно из UserID и
+// SystemAccount заполнено; Amount > 0 увеличивает баланс счёта.
+type LedgerPosting struct {
+	ID            int       `db:"id"`
+	TransactionID int       `db:"transaction_id"`
+	UserID        *int      `db:"user_id"`
+	SystemAccount *string   `db:"system_account"`
+	Amount        int       `db:"amount"`
+	CreatedAt     time.Time `db:"created_at"`
+}
+
+// Системные счета журнала.
+const (
+	AccountStore    = "store"
+	AccountTreasury = "treasury"
+)
+
+type BalanceDrift struct {
+	UserID        int    `json:"userId"`
+	Username      string `json:"username"`
+	StoredBalance int    `json:"storedBalance"`
+	LedgerBalance int    `json:"ledgerBalance"`
+}
+
+type ReconciliationReport struct {
+	Drifts                 []BalanceDrift `json:"drifts"`
+	UnbalancedTransactions []int          `json:"unbalancedTransactions"`
+	// NegativeBalances — расхождения, которые ремонт пропустил: баланс по
+	// журналу отрицательный, и в users.coins его не записать. Разбираются
+	// вручную.
+	NegativeBalances []BalanceDrift `json:"negativeBalances"`
+	Repaired         bool           `json:"repaired"`
+}
+
+type IdempotencyKey struct {
+	UserID       int       `db:"user_id"`
+	Key          string    `db:"idem_key"`
+	Fingerprint  string    `db:"fingerprint"`
+	StatusCode   int       `db:"status_code"`
+	ResponseBody []byte    `db:"response_body"`
+	CreatedAt    time.Time `db:"created_at"`
+	ExpiresAt    time.Time `db:"expires_at"`
+}
+
+// IdempotentResponse — сохранённый ответ на запрос с Idempotency-Key.
+type IdempotentResponse struct {
+	StatusCode int
+	Body       []byte
 }
 
 type ItemPurchase struct {
@@ -22,7 +95,43 @@ type ItemPurchase struct {
 	UserID    int       `db:"user_id"`
 	ItemName  string    `db:"item_name"`
 	Quantity  int       `db:"quantity"`
+	OrderID   *int      `db:"order_id"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+type CartItem struct {
+	UserID   int       `db:"user_id"`
+	ItemName string    `db:"item_name"`
+	Quantity int       `db:"quantity"`
+	AddedAt  time.Time `db:"added_at"`
+}
+
+type Order struct {
+	ID        int       `db:"id"`
+	UserID    int       `db:"user_id"`
+	Total     int       `db:"total"`
+	Status    string    `db:"status"`
 	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+}
+
+const (
+	OrderPlaced         = "placed"
+	OrderReadyForPickup = "ready_for_pickup"
+	OrderDelivered      = "delivered"
+	OrderCancelled      = "cancelled"
+)
+
+type Item struct {
+	ID          int       `db:"id"`
+	Name        string    `db:"name"`
+	Title       string    `db:"title"`
+	Description string    `db:"description"`
+	Price       int       `db:"price"`
+	Stock       *int      `db:"stock"` // nil — неограниченный запас
+	Active      bool      `db:"active"`
+	CreatedAt   time.Time `db:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at"`
 }
 
 
@@ -31,8 +140,145 @@ type AuthRequest struct {
 	Password string `json:"password"`
 }
 
+// AuthResponse — ответ на вход. Если у пользователя включена 2FA, вместо
+// token приходит mfaToken, который вместе с кодом обменивается на токены
+// через POST /api/auth/mfa.
 type AuthResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refreshToken,omitempty"`
+	ExpiresIn    int    `json:"expiresIn,omitempty"` // время жизни token, секунды
+	MFARequired  bool   `json:"mfaRequired,omitempty"`
+	MFAToken     string `json:"mfaToken,omitempty"`
+}
+
+type MFAVerifyRequest struct {
+	MFAToken string `json:"mfaToken"`
+	// Code — 6 цифр из приложения или код восстановления.
+	Code string `json:"code"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code"`
+}
+
+type TOTPEnrollResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioningUri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// UserTOTP — настройки TOTP пользователя.
+type UserTOTP struct {
+	UserID       int    `db:"user_id"`
+	Secret       string `db:"secret"`
+	Enabled      bool   `db:"enabled"`
+	LastUsedStep int64  `db:"last_used_step"`
+}
+
+// ChangePasswordRequest — тело POST /api/me/password.
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+// PasswordResetResponse — токен сброса; показывается админу один раз.
+type PasswordResetResponse struct {
+	ResetToken string    `json:"resetToken"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// ResetPasswordRequest — тело POST /api/auth/password-reset.
+type ResetPasswordRequest struct {
+	ResetToken  string `json:"resetToken"`
+	NewPassword string `json:"newPassword"`
+}
+
+type PasswordResetToken struct {
+	ID        int        `db:"id"`
+	UserID    int        `db:"user_id"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
+}
+
+// LoginAttempts — счётчик неудачных входов по одному ключу.
+type LoginAttempts struct {
+	Key           string     `db:"key"`
+	Failures      int        `db:"failures"`
+	LastFailureAt time.Time  `db:"last_failure_at"`
+	LockedUntil   *time.Time `db:"locked_until"`
+}
+
+// AccessClaims — содержимое access-токена.
+type AccessClaims struct {
+	UserID       int
+	Username     string
+	Role         string
+	Scopes       []string
+	SessionID    int
+	TokenVersion int
+	// TokenID — jti, уникальный для каждого выпущенного токена.
+	TokenID string
+}
+
+// Principal — кто выполняет запрос: пользователь по access-токену или по
+// API-ключу. Кладётся в контекст запроса JwtMiddleware.
+type Principal struct {
+	UserID   int
+	Username string
+	Roles    []string
+	Scopes   []string
+	// TokenID — jti access-токена или "apikey:<id>".
+	TokenID string
+	// SessionID — сессия access-токена; 0 для API-ключа.
+	SessionID int
+	// APIKeyID — 0 для access-токена.
+	APIKeyID int
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// LogoutRequest — тело POST /api/auth/logout. Everywhere завершает все
+// сессии пользователя, иначе — только текущую.
+type LogoutRequest struct {
+	Everywhere bool `json:"everywhere"`
+}
+
+// RefreshToken — запись refresh_tokens вместе с состоянием её сессии и
+// текущими ролью и token_version владельца.
+type RefreshToken struct {
+	ID             int        `db:"id"`
+	SessionID      int        `db:"session_id"`
+	UserID         int        `db:"user_id"`
+	TokenHash      string     `db:"token_hash"`
+	ExpiresAt      time.Time  `db:"expires_at"`
+	UsedAt         *time.Time `db:"used_at"`
+	SessionRevoked bool       `db:"session_revoked"`
+	Role           string     `db:"role"`
+	TokenVersion   int        `db:"token_version"`
+	Username       string     `db:"username"`
 }
 
 type InfoResponse struct {
@@ -44,6 +290,11 @@ type InfoResponse struct {
 type InvItem struct {
 	Type     string `json:"type"`
 	Quantity int    `json:"quantity"`
+	// Данные из каталога; у снятого с продажи товара остаются прежние.
+	Title            string    `json:"title,omitempty"`
+	UnitPrice        int       `json:"unitPrice,omitempty"`
+	FirstPurchasedAt time.Time `json:"firstPurchasedAt"`
+	LastPurchasedAt  time.Time `json:"lastPurchasedAt"`
 }
 
 type CoinHistory struct {
@@ -54,16 +305,259 @@ type CoinHistory struct {
 type ReceivedCoin struct {
 	FromUser string `json:"fromUser"`
 	Amount   int    `json:"amount"`
+	Kind     string `json:"kind"`
+	OrderID  *int   `json:"orderId,omitempty"`
+	Memo     string `json:"memo,omitempty"`
 }
 
 type SentCoin struct {
+	ToUser  string `json:"toUser"`
+	Amount  int    `json:"amount"`
+	Kind    string `json:"kind"`
+	OrderID *int   `json:"orderId,omitempty"`
+	Memo    string `json:"memo,omitempty"`
+}
+
+// CounterpartyTotal — сумма и число записей журнала с одной второй стороной
+// в одном направлении ("sent"/"received").
+type CounterpartyTotal struct {
+	Direction    string `db:"direction"`
+	Counterparty string `db:"counterparty"`
+	Amount       int    `db:"amount"`
+	Count        int    `db:"count"`
+}
+
+// AggregatedInfoResponse — ответ GET /api/info?history=aggregated.
+type AggregatedInfoResponse struct {
+	Coins       int                   `json:"coins"`
+	Inventory   []InvItem             `json:"inventory"`
+	CoinHistory AggregatedCoinHistory `json:"coinHistory"`
+}
+
+type AggregatedCoinHistory struct {
+	Received []ReceivedTotal `json:"received"`
+	Sent     []SentTotal     `json:"sent"`
+}
+
+type ReceivedTotal struct {
+	FromUser string `json:"fromUser"`
+	Amount   int    `json:"amount"`
+	Count    int    `json:"count"`
+}
+
+type SentTotal struct {
 	ToUser string `json:"toUser"`
 	Amount int    `json:"amount"`
+	Count  int    `json:"count"`
 }
 
 type SendCoinRequest struct {
 	ToUser string `json:"toUser"`
 	Amount int    `json:"amount"`
+	Memo   string `json:"memo,omitempty"`
+}
+
+// BuyRequest — тело POST /api/buy/{item}; без quantity покупается одна штука.
+type BuyRequest struct {
+	Quantity *int `json:"quantity"`
+}
+
+type CatalogItem struct {
+	Name        string `json:"name"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Price       int    `json:"price"`
+	Stock       *int   `json:"stock"` // null — неограниченный запас
+}
+
+type ItemsResponse struct {
+	Items []CatalogItem `json:"items"`
+}
+
+type CreateItemRequest struct {
+	Name        string `json:"name"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Price       int    `json:"price"`
+	Stock       *int   `json:"stock"`
+}
+
+type AdminItem struct {
+	Name        string    `json:"name"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Price       int       `json:"price"`
+	Stock       *int      `json:"stock"`
+	Active      bool      `json:"active"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// UpdateItemRequest — частичное обновление: nil-поля не меняются.
+type UpdateItemRequest struct {
+	Title       *string `json:"title,omitempty"`
+	Description *string `json:"description,omitempty"`
+	Price       *int    `json:"price,omitempty"`
+	Active      *bool   `json:"active,omitempty"`
+}
+
+type RestockRequest struct {
+	Quantity int `json:"quantity"`
+}
+
+// SetStockRequest задаёт остаток целиком; stock = null делает запас неограниченным.
+type SetStockRequest struct {
+	Stock *int `json:"stock"`
+}
+
+type AddToCartRequest struct {
+	Item     string `json:"item"`
+	Quantity int    `json:"quantity"`
+}
+
+type CartLine struct {
+	Item     string `json:"item"`
+	Title    string `json:"title"`
+	Price    int    `json:"price"`
+	Quantity int    `json:"quantity"`
+	Subtotal int    `json:"subtotal"`
+}
+
+type CartResponse struct {
+	Items []CartLine `json:"items"`
+	Total int        `json:"total"`
+}
+
+type CheckoutResponse struct {
+	OrderID int `json:"orderId"`
+	Total   int `json:"total"`
+}
+
+type OrderInfo struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"userId"`
+	Status    string    `json:"status"`
+	Total     int       `json:"total"`
+	Items     []InvItem `json:"items"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type OrdersResponse struct {
+	Orders []OrderInfo `json:"orders"`
+}
+
+type OrderStatusRequest struct {
+	Status string `json:"status"`
+}
+
+// TransactionFilter — параметры выборки истории из coin_transactions.
+// Нулевые значения означают «без фильтра».
+type TransactionFilter struct {
+	UserID         int
+	Direction      string // "sent", "received" или ""
+	CounterpartyID *int
+	Kind           string
+	From           *time.Time
+	To             *time.Time
+	// Курсор: вернуть записи строго старше (AfterCreatedAt, AfterID).
+	AfterCreatedAt *time.Time
+	AfterID        int
+	Limit          int
+}
+
+// TransactionQuery — параметры GET /api/transactions в разобранном виде.
+type TransactionQuery struct {
+	Direction    string
+	Counterparty string
+	Kind         string
+	From         *time.Time
+	To           *time.Time
+	Cursor       string
+	Limit        int
+}
+
+type TransactionEntry struct {
+	ID           int       `json:"id"`
+	Direction    string    `json:"direction"`
+	Counterparty string    `json:"counterparty"`
+	Amount       int       `json:"amount"`
+	Kind         string    `json:"kind"`
+	OrderID      *int      `json:"orderId,omitempty"`
+	Memo         string    `json:"memo,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+type TransactionsResponse struct {
+	Transactions []TransactionEntry `json:"transactions"`
+	NextCursor   string             `json:"nextCursor,omitempty"`
+}
+
+// Области доступа. API-ключу можно выдать только первые три; account и
+// admin есть лишь у access-токенов интерактивных сессий.
+const (
+	ScopeInfoRead  = "info:read"  // баланс, история, каталог, заказы, корзина
+	ScopeCoinsSend = "coins:send" // перевод монет
+	ScopeItemsBuy  = "items:buy"  // покупки, корзина, оформление и отмена заказов
+	ScopeAccount   = "account"    // свой аккаунт: API-ключи, 2FA, пароль, выход
+	ScopeAdmin     = "admin"      // админка; только для роли admin
+)
+
+// APIKey — строка api_keys. Username и Role заполняются только при поиске
+// по хэшу.
+type APIKey struct {
+	ID         int        `db:"id"`
+	UserID     int        `db:"user_id"`
+	Name       string     `db:"name"`
+	Prefix     string     `db:"prefix"`
+	KeyHash    string     `db:"key_hash"`
+	Scopes     []string   `db:"scopes"`
+	ExpiresAt  time.Time  `db:"expires_at"`
+	LastUsedAt *time.Time `db:"last_used_at"`
+	RevokedAt  *time.Time `db:"revoked_at"`
+	CreatedAt  time.Time  `db:"created_at"`
+	Username   string     `db:"username"`
+	Role       string     `db:"role"`
+}
+
+// CreateAPIKeyRequest — тело POST /api/keys. Без expiresAt ключ живёт
+// срок по умолчанию.
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+type APIKeyInfo struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// CreatedAPIKey — ответ на создание; Key больше нигде не возвращается.
+type CreatedAPIKey struct {
+	APIKeyInfo
+	Key string `json:"key"`
+}
+
+type APIKeysResponse struct {
+	Keys []APIKeyInfo `json:"keys"`
+}
+
+// OIDCLoginStart — куда отправить браузер и подписанное состояние входа
+// (state, nonce, PKCE verifier), которое хранится в cookie до callback.
+type OIDCLoginStart struct {
+	AuthURL    string
+	StateToken string
+}
+
+// OIDCLinkResponse — куда отправить браузер, чтобы привязать учётную
+// запись провайдера к текущему пользователю.
+type OIDCLinkResponse struct {
+	AuthURL string `json:"authUrl"`
 }
 
 type ErrorResponse struct {
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"database/sql"
+
+	"avito-shop/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// InsertAPIKey сохраняет ключ и заполняет key.ID и key.CreatedAt.
+func (r *PostgresRepo) InsertAPIKey(key *models.APIKey) error {
+	query := `INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at)
+			  VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`
+	return r.q.QueryRow(query, key.UserID, key.Name, key.Prefix, key.KeyHash, pq.Array(key.Scopes), key.ExpiresAt).
+		Scan(&key.ID, &key.CreatedAt)
+}
+
+func (r *PostgresRepo) ListAPIKeys(userID int) ([]models.APIKey, error) {
+	query := `SELECT id, user_id, name, prefix, scopes, expires_at, last_used_at, created_at
+			  FROM api_keys WHERE user_id = $1 AND revoked_at IS NULL
+			  ORDER BY created_at DESC, id DESC`
+	rows, err := r.q.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []models.APIKey
+	for rows.Next() {
+		var k models.APIKey
+		if err := rows.Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, pq.Array(&k.Scopes), &k.ExpiresAt, &k.LastUsedAt, &k.CreatedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func (r *PostgresRepo) GetAPIKeyByHash(keyHash string) (*models.APIKey, error) {
+	query := `SELECT k.id, k.user_id, k.name, k.prefix, k.scopes, k.expires_at, k.last_used_at, k.created_at, u.username, u.role
+			  FROM api_keys k
+			  JOIN users u ON u.id = k.user_id
+			  WHERE k.key_hash = $1 AND k.revoked_at IS NULL`
+	var k models.APIKey
+	err := r.q.QueryRow(query, keyHash).Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, pq.Array(&k.Scopes),
+		&k.ExpiresAt, &k.LastUsedAt, &k.CreatedAt, &k.Username, &k.Role)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	k.KeyHash = keyHash
+	return &k, nil
+}
+
+func (r *PostgresRepo) RevokeAPIKey(userID, keyID int) (bool, error) {
+	query := `UPDATE api_keys SET revoked_at = NOW()
+			  WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+	res, err := r.q.Exec(query, keyID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *PostgresRepo) RevokeAllAPIKeys(userID int) error {
+	query := `UPDATE api_keys SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+	_, err := r.q.Exec(query, userID)
+	return err
+}
+
+// TouchAPIKey обновляет last_used_at не чаще раза в минуту, чтобы каждый
+// запрос бота не превращался в запись.
+func (r *PostgresRepo) TouchAPIKey(keyID int) error {
+	query := `UPDATE api_keys SET last_used_at = NOW()
+			  WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')`
+	_, err := r.q.Exec(query, keyID)
+	return err
+}
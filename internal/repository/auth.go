@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"avito-shop/internal/models"
+)
+
+func (r *PostgresRepo) CreateAuthSession(userID int) (int, int, error) {
+	query := `INSERT INTO auth_sessions (user_id) VALUES ($1)
+			  RETURNING id, (SELECT token_version FROM users WHERE id = $1)`
+	var sessionID, tokenVersion int
+	err := r.q.QueryRow(query, userID).Scan(&sessionID, &tokenVersion)
+	return sessionID, tokenVersion, err
+}
+
+func (r *PostgresRepo) InsertRefreshToken(sessionID, userID int, tokenHash string, expiresAt time.Time) error {
+	query := `INSERT INTO refresh_tokens (session_id, user_id, token_hash, expires_at) VALUES ($1, $2, $3, $4)`
+	_, err := r.q.Exec(query, sessionID, userID, tokenHash, expiresAt)
+	return err
+}
+
+func (r *PostgresRepo) GetRefreshTokenForUpdate(tokenHash string) (*models.RefreshToken, error) {
+	query := `SELECT t.id, t.session_id, t.user_id, t.token_hash, t.expires_at, t.used_at,
+			         s.revoked_at IS NOT NULL, u.role, u.token_version, u.username
+			  FROM refresh_tokens t
+			  JOIN auth_sessions s ON s.id = t.session_id
+			  JOIN users u ON u.id = t.user_id
+			  WHERE t.token_hash = $1
+			  FOR UPDATE OF t`
+	var t models.RefreshToken
+	err := r.q.QueryRow(query, tokenHash).Scan(&t.ID, &t.SessionID, &t.UserID, &t.TokenHash, &t.ExpiresAt, &t.UsedAt,
+		&t.SessionRevoked, &t.Role, &t.TokenVersion, &t.Username)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *PostgresRepo) MarkRefreshTokenUsed(id int) error {
+	query := `UPDATE refresh_tokens SET used_at = NOW() WHERE id = $1`
+	_, err := r.q.Exec(query, id)
+	return err
+}
+
+func (r *PostgresRepo) RevokeAuthSession(userID, sessionID int) error {
+	query := `UPDATE auth_sessions SET revoked_at = NOW()
+			  WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+	_, err := r.q.Exec(query, sessionID, userID)
+	return err
+}
+
+func (r *PostgresRepo) RevokeAllAuthSessions(userID int) error {
+	query := `UPDATE auth_sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+	_, err := r.q.Exec(query, userID)
+	return err
+}
+
+func (r *PostgresRepo) BumpTokenVersion(userID int) error {
+	query := `UPDATE users SET token_version = token_version + 1 WHERE id = $1`
+	_, err := r.q.Exec(query, userID)
+	return err
+}
+
+func (r *PostgresRepo) IsSessionActive(userID, sessionID, tokenVersion int) (bool, error) {
+	query := `SELECT EXISTS (
+			      SELECT 1 FROM auth_sessions s
+			      JOIN users u ON u.id = s.user_id
+			      WHERE s.id = $1 AND s.user_id = $2 AND s.revoked_at IS NULL AND u.token_version = $3
+			  )`
+	var active bool
+	err := r.q.QueryRow(query, sessionID, userID, tokenVersion).Scan(&active)
+	return active, err
+}
+
+func (r *PostgresRepo) DeleteExpiredRefreshTokens() (int64, error) {
+	query := `DELETE FROM refresh_tokens WHERE expires_at < NOW()`
+	res, err := r.q.Exec(query)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
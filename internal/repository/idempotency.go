@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"avito-shop/internal/models"
+)
+
+func (r *PostgresRepo) ReserveIdempotencyKey(userID int, key, fingerprint string, expiresAt time.Time) (bool, error) {
+	// Параллельный запрос с тем же ключом ждёт на уникальном индексе, пока
+	// первая транзакция не завершится, и затем видит уже сохранённый ответ.
+	query := `INSERT INTO idempotency_keys (user_id, idem_key, fingerprint, expires_at)
+			  VALUES ($1, $2, $3, $4)
+			  ON CONFLICT (user_id, idem_key) DO UPDATE
+			  SET fingerprint = EXCLUDED.fingerprint, status_code = NULL, response_body = NULL,
+			      created_at = NOW(), expires_at = EXCLUDED.expires_at
+			  WHERE idempotency_keys.expires_at < NOW()`
+	res, err := r.q.Exec(query, userID, key, fingerprint, expiresAt)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *PostgresRepo) GetIdempotencyKey(userID int, key string) (*models.IdempotencyKey, error) {
+	query := `SELECT user_id, idem_key, fingerprint, COALESCE(status_code, 0), response_body, created_at, expires_at
+			  FROM idempotency_keys WHERE user_id = $1 AND idem_key = $2`
+	var k models.IdempotencyKey
+	err := r.q.QueryRow(query, userID, key).Scan(&k.UserID, &k.Key, &k.Fingerprint, &k.StatusCode, &k.ResponseBody, &k.CreatedAt, &k.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+func (r *PostgresRepo) SaveIdempotentResponse(userID int, key string, statusCode int, body []byte) error {
+	query := `UPDATE idempotency_keys SET status_code = $1, response_body = $2
+			  WHERE user_id = $3 AND idem_key = $4`
+	_, err := r.q.Exec(query, statusCode, body, userID, key)
+	return err
+}
+
+func (r *PostgresRepo) DeleteExpiredIdempotencyKeys() (int64, error) {
+	query := `DELETE FROM idempotency_keys WHERE expires_at < NOW()`
+	res, err := r.q.Exec(query)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+
+	"avito-shop/internal/models"
+
+	"github.com/lib/pq"
+)
+
+func (r *PostgresRepo) GetUserByIdentity(issuer, subject string) (*models.User, error) {
+	query := `SELECT u.id, u.username, u.password, u.coins, u.role
+			  FROM user_identities i
+			  JOIN users u ON u.id = i.user_id
+			  WHERE i.issuer = $1 AND i.subject = $2`
+	var user models.User
+	err := r.q.QueryRow(query, issuer, subject).Scan(&user.ID, &user.Username, &user.Password, &user.Coins, &user.Role)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *PostgresRepo) InsertUserIdentity(userID int, issuer, subject string) error {
+	query := `INSERT INTO user_identities (issuer, subject, user_id) VALUES ($1, $2, $3)`
+	_, err := r.q.Exec(query, issuer, subject, userID)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == pqUniqueViolation {
+		return ErrAlreadyExists
+	}
+	return err
+}
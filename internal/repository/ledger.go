@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"avito-shop/internal/models"
+)
+
+// postingsFor раскладывает запись журнала на две проводки. Пустая сторона
+// (NULL в from_user_id/to_user_id) относится к системному счёту: покупки
+// зачисляются магазину, возвраты списываются с него, остальное — treasury.
+func postingsFor(t models.CoinTransaction) [2]models.LedgerPosting {
+	debit := models.LedgerPosting{TransactionID: t.ID, UserID: t.FromUserID, Amount: -t.Amount}
+	if t.FromUserID == nil {
+		debit.SystemAccount = systemAccount(t.Kind == models.TxRefund)
+	}
+	credit := models.LedgerPosting{TransactionID: t.ID, UserID: t.ToUserID, Amount: t.Amount}
+	if t.ToUserID == nil {
+		credit.SystemAccount = systemAccount(t.Kind == models.TxPurchase)
+	}
+	return [2]models.LedgerPosting{debit, credit}
+}
+
+func systemAccount(store bool) *string {
+	account := models.AccountTreasury
+	if store {
+		account = models.AccountStore
+	}
+	return &account
+}
+
+func (r *PostgresRepo) insertPostings(t models.CoinTransaction) error {
+	p := postingsFor(t)
+	query := `INSERT INTO ledger_postings (transaction_id, user_id, system_account, amount)
+			  VALUES ($1, $2, $3, $4), ($1, $5, $6, $7)`
+	_, err := r.q.Exec(query, t.ID,
+		p[0].UserID, p[0].SystemAccount, p[0].Amount,
+		p[1].UserID, p[1].SystemAccount, p[1].Amount)
+	return err
+}
+
+func (r *PostgresRepo) GetLedgerBalance(userID int) (int, error) {
+	query := `SELECT COALESCE(SUM(amount), 0) FROM ledger_postings WHERE user_id = $1`
+	var balance int
+	err := r.q.QueryRow(query, userID).Scan(&balance)
+	return balance, err
+}
+
+func (r *PostgresRepo) GetBalanceDrifts() ([]models.BalanceDrift, error) {
+	query := `SELECT u.id, u.username, u.coins, COALESCE(l.balance, 0)
+			  FROM users u
+			  LEFT JOIN (
+			      SELECT user_id, SUM(amount) AS balance
+			      FROM ledger_postings WHERE user_id IS NOT NULL
+			      GROUP BY user_id
+			  ) l ON l.user_id = u.id
+			  WHERE u.coins <> COALESCE(l.balance, 0)
+			  ORDER BY u.id`
+	rows, err := r.q.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var drifts []models.BalanceDrift
+	for rows.Next() {
+		var d models.BalanceDrift
+		if err := rows.Scan(&d.UserID, &d.Username, &d.StoredBalance, &d.LedgerBalance); err != nil {
+			return nil, err
+		}
+		drifts = append(drifts, d)
+	}
+	return drifts, rows.Err()
+}
+
+func (r *PostgresRepo) GetUnbalancedTransactions() ([]int, error) {
+	query := `SELECT t.id
+			  FROM coin_transactions t
+			  LEFT JOIN ledger_postings p ON p.transaction_id = t.id
+			  GROUP BY t.id
+			  HAVING COUNT(p.id) = 0 OR SUM(p.amount) <> 0
+			  ORDER BY t.id`
+	rows, err := r.q.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
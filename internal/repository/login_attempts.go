@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"avito-shop/internal/models"
+)
+
+// LoginAttemptStore хранит счётчики неудачных входов. Ключ — строка вида
+// "user:alice" или "ip:10.0.0.1".
+type LoginAttemptStore interface {
+	// Reserve атомарно учитывает попытку входа до проверки пароля. Если по
+	// ключу действует блокировка (LockedUntil после now), ничего не меняет и
+	// возвращает текущее состояние с ok = false. Иначе увеличивает счётчик
+	// (счётчик, последняя неудача которого старше window, начинается заново)
+	// и сразу ставит блокировку на lockFor(failures), как будто попытка уже
+	// не удалась; нулевая длительность блокировку не ставит.
+	Reserve(key string, now time.Time, window time.Duration, lockFor func(failures int) time.Duration) (a *models.LoginAttempts, ok bool, err error)
+	// Release отменяет резерв удавшейся попытки: уменьшает счётчик и снимает
+	// блокировку lockedUntil, поставленную резервом, если её не сменили.
+	Release(key string, lockedUntil *time.Time) error
+	Reset(key string) error
+	// Purge удаляет записи без неудач и блокировок после before.
+	Purge(before time.Time) (int64, error)
+}
+
+// nextAttempt учитывает в a ещё одну попытку.
+func nextAttempt(a *models.LoginAttempts, now time.Time, window time.Duration, lockFor func(failures int) time.Duration) {
+	if a.LastFailureAt.Before(now.Add(-window)) {
+		a.Failures = 0
+	}
+	a.Failures++
+	a.LastFailureAt = now
+	if d := lockFor(a.Failures); d > 0 {
+		until := now.Add(d)
+		a.LockedUntil = &until
+	}
+}
+
+// ----------------------------------------
+// In-memory
+// ----------------------------------------
+
+// MemoryLoginAttemptStore — хранилище в памяти процесса; подходит для
+// одного экземпляра сервиса.
+type MemoryLoginAttemptStore struct {
+	mu       sync.Mutex
+	attempts map[string]models.LoginAttempts
+}
+
+func NewMemoryLoginAttemptStore() *MemoryLoginAttemptStore {
+	return &MemoryLoginAttemptStore{attempts: make(map[string]models.LoginAttempts)}
+}
+
+func (m *MemoryLoginAttemptStore) Reserve(key string, now time.Time, window time.Duration, lockFor func(failures int) time.Duration) (*models.LoginAttempts, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.attempts[key]
+	if !ok {
+		a = models.LoginAttempts{Key: key}
+	}
+	if a.LockedUntil != nil && a.LockedUntil.After(now) {
+		return &a, false, nil
+	}
+	nextAttempt(&a, now, window, lockFor)
+	m.attempts[key] = a
+	return &a, true, nil
+}
+
+func (m *MemoryLoginAttemptStore) Release(key string, lockedUntil *time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.attempts[key]
+	if !ok {
+		return nil
+	}
+	if a.Failures > 0 {
+		a.Failures--
+	}
+	if lockedUntil != nil && a.LockedUntil != nil && a.LockedUntil.Equal(*lockedUntil) {
+		a.LockedUntil = nil
+	}
+	m.attempts[key] = a
+	return nil
+}
+
+func (m *MemoryLoginAttemptStore) Reset(key string) error {
+	m.mu.Lock()
+	delete(m.attempts, key)
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *MemoryLoginAttemptStore) Purge(before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for key, a := range m.attempts {
+		if a.LastFailureAt.Before(before) && (a.LockedUntil == nil || a.LockedUntil.Before(before)) {
+			delete(m.attempts, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// ----------------------------------------
+// Postgres
+// ----------------------------------------
+
+// PostgresLoginAttemptStore — хранилище в таблице login_attempts, общее
+// для всех экземпляров сервиса.
+type PostgresLoginAttemptStore struct {
+	db *sql.DB
+}
+
+func NewPostgresLoginAttemptStore(db *sql.DB) *PostgresLoginAttemptStore {
+	return &PostgresLoginAttemptStore{db: db}
+}
+
+func (p *PostgresLoginAttemptStore) Reserve(key string, now time.Time, window time.Duration, lockFor func(failures int) time.Duration) (*models.LoginAttempts, bool, error) {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	// Строка блокируется до конца транзакции, поэтому параллельные попытки
+	// по одному ключу учитываются по очереди.
+	insert := `INSERT INTO login_attempts (key, last_failure_at) VALUES ($1, $2) ON CONFLICT (key) DO NOTHING`
+	if _, err := tx.Exec(insert, key, now); err != nil {
+		return nil, false, err
+	}
+	query := `SELECT key, failures, last_failure_at, locked_until FROM login_attempts WHERE key = $1 FOR UPDATE`
+	var a models.LoginAttempts
+	if err := tx.QueryRow(query, key).Scan(&a.Key, &a.Failures, &a.LastFailureAt, &a.LockedUntil); err != nil {
+		return nil, false, err
+	}
+	if a.LockedUntil != nil && a.LockedUntil.After(now) {
+		return &a, false, nil
+	}
+
+	nextAttempt(&a, now, window, lockFor)
+	// locked_until читается обратно, чтобы Release сравнивал значение в
+	// точности БД.
+	update := `UPDATE login_attempts SET failures = $2, last_failure_at = $3, locked_until = $4
+			   WHERE key = $1 RETURNING locked_until`
+	if err := tx.QueryRow(update, key, a.Failures, a.LastFailureAt, a.LockedUntil).Scan(&a.LockedUntil); err != nil {
+		return nil, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, false, err
+	}
+	return &a, true, nil
+}
+
+func (p *PostgresLoginAttemptStore) Release(key string, lockedUntil *time.Time) error {
+	query := `UPDATE login_attempts
+			  SET failures = GREATEST(failures - 1, 0),
+			      locked_until = CASE WHEN locked_until = $2 THEN NULL ELSE locked_until END
+			  WHERE key = $1`
+	_, err := p.db.Exec(query, key, lockedUntil)
+	return err
+}
+
+func (p *PostgresLoginAttemptStore) Reset(key string) error {
+	query := `DELETE FROM login_attempts WHERE key = $1`
+	_, err := p.db.Exec(query, key)
+	return err
+}
+
+func (p *PostgresLoginAttemptStore) Purge(before time.Time) (int64, error) {
+	query := `DELETE FROM login_attempts
+			  WHERE last_failure_at < $1 AND (locked_until IS NULL OR locked_until < $1)`
+	res, err := p.db.Exec(query, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
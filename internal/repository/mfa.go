@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"database/sql"
+
+	"avito-shop/internal/models"
+
+	"github.com/lib/pq"
+)
+
+func (r *PostgresRepo) GetUserTOTP(userID int) (*models.UserTOTP, error) {
+	query := `SELECT user_id, secret, enabled, last_used_step FROM user_totp WHERE user_id = $1`
+	var t models.UserTOTP
+	err := r.q.QueryRow(query, userID).Scan(&t.UserID, &t.Secret, &t.Enabled, &t.LastUsedStep)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *PostgresRepo) SaveTOTPSecret(userID int, secret string) error {
+	query := `INSERT INTO user_totp (user_id, secret) VALUES ($1, $2)
+			  ON CONFLICT (user_id) DO UPDATE
+			  SET secret = EXCLUDED.secret, enabled = FALSE, last_used_step = 0, created_at = NOW()`
+	_, err := r.q.Exec(query, userID, secret)
+	return err
+}
+
+func (r *PostgresRepo) EnableTOTP(userID int) error {
+	query := `UPDATE user_totp SET enabled = TRUE WHERE user_id = $1`
+	_, err := r.q.Exec(query, userID)
+	return err
+}
+
+func (r *PostgresRepo) UseTOTPStep(userID int, step int64) (bool, error) {
+	query := `UPDATE user_totp SET last_used_step = $1 WHERE user_id = $2 AND last_used_step < $1`
+	res, err := r.q.Exec(query, step, userID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *PostgresRepo) DeleteTOTP(userID int) error {
+	if _, err := r.q.Exec(`DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	_, err := r.q.Exec(`DELETE FROM user_totp WHERE user_id = $1`, userID)
+	return err
+}
+
+func (r *PostgresRepo) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	if _, err := r.q.Exec(`DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	query := `INSERT INTO recovery_codes (user_id, code_hash) SELECT $1, unnest($2::text[])`
+	_, err := r.q.Exec(query, userID, pq.Array(codeHashes))
+	return err
+}
+
+func (r *PostgresRepo) UseRecoveryCode(userID int, codeHash string) (bool, error) {
+	query := `UPDATE recovery_codes SET used_at = NOW()
+			  WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+	res, err := r.q.Exec(query, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"avito-shop/internal/models"
+)
+
+func (r *PostgresRepo) UpdateUserPassword(userID int, passwordHash string) error {
+	query := `UPDATE users SET password = $1 WHERE id = $2`
+	_, err := r.q.Exec(query, passwordHash, userID)
+	return err
+}
+
+func (r *PostgresRepo) InsertPasswordResetToken(userID int, tokenHash string, expiresAt time.Time, createdBy int) error {
+	query := `INSERT INTO password_reset_tokens (user_id, token_hash, expires_at, created_by) VALUES ($1, $2, $3, $4)`
+	_, err := r.q.Exec(query, userID, tokenHash, expiresAt, createdBy)
+	return err
+}
+
+func (r *PostgresRepo) GetPasswordResetTokenForUpdate(tokenHash string) (*models.PasswordResetToken, error) {
+	query := `SELECT id, user_id, expires_at, used_at FROM password_reset_tokens
+			  WHERE token_hash = $1 FOR UPDATE`
+	var t models.PasswordResetToken
+	err := r.q.QueryRow(query, tokenHash).Scan(&t.ID, &t.UserID, &t.ExpiresAt, &t.UsedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *PostgresRepo) MarkPasswordResetTokenUsed(id int) error {
+	query := `UPDATE password_reset_tokens SET used_at = NOW() WHERE id = $1`
+	_, err := r.q.Exec(query, id)
+	return err
+}
+
+func (r *PostgresRepo) DeleteExpiredPasswordResetTokens() (int64, error) {
+	query := `DELETE FROM password_reset_tokens WHERE expires_at < NOW() OR used_at IS NOT NULL`
+	res, err := r.q.Exec(query)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -2,30 +2,185 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"time"
 
 	"avito-shop/internal/config"
 	"avito-shop/internal/models"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+)
+
+// ErrBalanceTooLow — списание сделало бы баланс отрицательным: условный
+// UPDATE не затронул ни одной строки или сработал CHECK (coins >= 0).
+var ErrBalanceTooLow = errors.New("balance too low")
+
+// ErrStockTooLow — на складе меньше единиц товара, чем запрошено.
+var ErrStockTooLow = errors.New("stock too low")
+
+// ErrAlreadyExists — нарушено ограничение уникальности.
+var ErrAlreadyExists = errors.New("already exists")
+
+const (
+	pqCheckViolation  = "23514" // SQLSTATE check_violation
+	pqUniqueViolation = "23505" // SQLSTATE unique_violation
 )
 
 type Repository interface {
+	// WithTx выполняет fn в одной транзакции БД. Repository, переданный в fn,
+	// привязан к этой транзакции: если fn вернула ошибку — откат, иначе commit.
+	WithTx(fn func(repo Repository) error) error
+
 	GetUserByUsername(username string) (*models.User, error)
 	CreateUser(username, password string) (int, error)
 	UpdateUserCoins(userID, newAmount int) error
 
-	InsertCoinTransaction(fromUserID, toUserID *int, amount int) error
+	// InsertCoinTransaction пишет запись журнала вместе с парой проводок
+	// в ledger_postings; пустой Kind — transfer.
+	InsertCoinTransaction(t models.CoinTransaction) error
+	// GetCoinTransactionsByUserID — вся история пользователя с именами
+	// участников (одним запросом).
 	GetCoinTransactionsByUserID(userID int) ([]models.CoinTransaction, error)
+	// FindCoinTransactions — страница истории пользователя по фильтру, от
+	// новых к старым, с именами участников.
+	FindCoinTransactions(f models.TransactionFilter) ([]models.CoinTransaction, error)
+	// GetCoinTotalsByCounterparty — суммы и количества записей пользователя,
+	// сгруппированные по направлению и второй стороне.
+	GetCoinTotalsByCounterparty(userID int) ([]models.CounterpartyTotal, error)
 
 	InsertItemPurchase(userID int, itemName string, quantity int) error
 	GetAllPurchasesByUserID(userID int) ([]models.ItemPurchase, error)
 
+	GetActiveItems() ([]models.Item, error)
+	GetItemByName(name string) (*models.Item, error)
+	// GetItemsByNames читает товары по именам, включая снятые с продажи.
+	GetItemsByNames(names []string) ([]models.Item, error)
+	// GetItemByNameForUpdate читает товар (в том числе неактивный) и
+	// блокирует строку до конца транзакции.
+	GetItemByNameForUpdate(name string) (*models.Item, error)
+	CreateItem(item models.Item) (int, error)
+	// UpdateItem сохраняет поля товара и записывает в item новый updated_at.
+	UpdateItem(item *models.Item) error
+	// SetItemStock сохраняет item.Stock (nil — неограниченный запас) и
+	// записывает в item новый updated_at.
+	SetItemStock(item *models.Item) error
+	// DecrementItemStock уменьшает остаток на quantity, если его хватает;
+	// иначе возвращает ErrStockTooLow. Для неограниченного запаса — no-op.
+	DecrementItemStock(itemID, quantity int) error
+	// IncrementItemStock возвращает единицы на склад; для неограниченного
+	// запаса — no-op.
+	IncrementItemStock(itemName string, quantity int) error
+
+	InsertAuditEntry(actorUserID int, action, target, details string) error
+
+	GetCartItems(userID int) ([]models.CartItem, error)
+	// GetCartItemsForUpdate читает корзину и блокирует её строки до конца
+	// транзакции, чтобы параллельный checkout не оплатил её дважды.
+	GetCartItemsForUpdate(userID int) ([]models.CartItem, error)
+	// AddCartItem добавляет товар в корзину или увеличивает его количество.
+	AddCartItem(userID int, itemName string, quantity int) error
+	RemoveCartItem(userID int, itemName string) (bool, error)
+	ClearCart(userID int) error
+
+	CreateOrder(userID, total int) (int, error)
+	InsertOrderLine(orderID, userID int, itemName string, quantity int) error
+
+	GetOrdersByUserID(userID int) ([]models.Order, error)
+	// GetOrdersByStatus возвращает заказы всех пользователей; пустой status — без фильтра.
+	GetOrdersByStatus(status string) ([]models.Order, error)
+	GetOrderByIDForUpdate(orderID int) (*models.Order, error)
+	UpdateOrderStatus(orderID int, status string) error
+	GetOrderLines(orderIDs []int) ([]models.ItemPurchase, error)
+
 	GetUserByID(userID int) (*models.User, error)
+	// GetUserByIDForUpdate читает пользователя и блокирует строку до конца
+	// текущей транзакции (SELECT ... FOR UPDATE).
+	GetUserByIDForUpdate(userID int) (*models.User, error)
+	// AddUserCoins изменяет баланс на delta относительно значения в БД.
+	AddUserCoins(userID, delta int) error
+	// DebitUserCoins списывает amount, только если на балансе достаточно
+	// монет; иначе возвращает ErrBalanceTooLow.
+	DebitUserCoins(userID, amount int) error
+
+	// GetLedgerBalance — баланс пользователя, посчитанный по проводкам.
+	GetLedgerBalance(userID int) (int, error)
+	// GetBalanceDrifts — пользователи, у которых users.coins расходится с журналом.
+	GetBalanceDrifts() ([]models.BalanceDrift, error)
+	// GetUnbalancedTransactions — записи, проводки которых не сходятся в ноль.
+	GetUnbalancedTransactions() ([]int, error)
+
+	// ReserveIdempotencyKey занимает ключ для нового запроса. Возвращает
+	// false, если ключ уже занят и ещё не истёк; истёкший ключ перезанимается.
+	ReserveIdempotencyKey(userID int, key, fingerprint string, expiresAt time.Time) (bool, error)
+	GetIdempotencyKey(userID int, key string) (*models.IdempotencyKey, error)
+	SaveIdempotentResponse(userID int, key string, statusCode int, body []byte) error
+	DeleteExpiredIdempotencyKeys() (int64, error)
+
+	// CreateAuthSession открывает сессию и возвращает её id вместе с
+	// текущей token_version пользователя.
+	CreateAuthSession(userID int) (sessionID, tokenVersion int, err error)
+	InsertRefreshToken(sessionID, userID int, tokenHash string, expiresAt time.Time) error
+	// GetRefreshTokenForUpdate ищет токен по хэшу и блокирует строку, чтобы
+	// параллельные refresh одним токеном не прошли оба.
+	GetRefreshTokenForUpdate(tokenHash string) (*models.RefreshToken, error)
+	MarkRefreshTokenUsed(id int) error
+	RevokeAuthSession(userID, sessionID int) error
+	RevokeAllAuthSessions(userID int) error
+	// BumpTokenVersion инвалидирует все access-токены пользователя.
+	BumpTokenVersion(userID int) error
+	// IsSessionActive проверяет, что сессия не отозвана и token_version
+	// пользователя не менялась.
+	IsSessionActive(userID, sessionID, tokenVersion int) (bool, error)
+	DeleteExpiredRefreshTokens() (int64, error)
+
+	GetUserTOTP(userID int) (*models.UserTOTP, error)
+	// SaveTOTPSecret записывает новый, ещё не включённый секрет.
+	SaveTOTPSecret(userID int, secret string) error
+	EnableTOTP(userID int) error
+	// UseTOTPStep запоминает шаг принятого кода; false — код этого или более
+	// позднего шага уже использован.
+	UseTOTPStep(userID int, step int64) (bool, error)
+	// DeleteTOTP выключает 2FA и удаляет коды восстановления.
+	DeleteTOTP(userID int) error
+	ReplaceRecoveryCodes(userID int, codeHashes []string) error
+	// UseRecoveryCode гасит код; false — кода нет или он уже использован.
+	UseRecoveryCode(userID int, codeHash string) (bool, error)
+
+	// UpdateUserPassword записывает новый bcrypt-хэш пароля.
+	UpdateUserPassword(userID int, passwordHash string) error
+	InsertPasswordResetToken(userID int, tokenHash string, expiresAt time.Time, createdBy int) error
+	GetPasswordResetTokenForUpdate(tokenHash string) (*models.PasswordResetToken, error)
+	MarkPasswordResetTokenUsed(id int) error
+	DeleteExpiredPasswordResetTokens() (int64, error)
+
+	InsertAPIKey(key *models.APIKey) error
+	// ListAPIKeys возвращает неотозванные ключи пользователя, новые первыми.
+	ListAPIKeys(userID int) ([]models.APIKey, error)
+	// GetAPIKeyByHash ищет неотозванный ключ вместе с ролью владельца.
+	GetAPIKeyByHash(keyHash string) (*models.APIKey, error)
+	// RevokeAPIKey возвращает false, если у пользователя нет такого
+	// действующего ключа.
+	RevokeAPIKey(userID, keyID int) (bool, error)
+	RevokeAllAPIKeys(userID int) error
+	TouchAPIKey(keyID int) error
+
+	// GetUserByIdentity ищет пользователя, привязанного к внешней учётной
+	// записи провайдера issuer.
+	GetUserByIdentity(issuer, subject string) (*models.User, error)
+	InsertUserIdentity(userID int, issuer, subject string) error
+}
+
+// querier — общее подмножество методов *sql.DB и *sql.Tx.
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
 }
 
 type PostgresRepo struct {
 	db *sql.DB
+	q  querier
 }
 
 func NewPostgresDB(cfg *config.Config) (*sql.DB, error) {
@@ -46,14 +201,31 @@ func NewPostgresDB(cfg *config.Config) (*sql.DB, error) {
 func NewRepository(db *sql.DB) Repository {
 	return &PostgresRepo{
 		db: db,
+		q:  db,
 	}
 }
 
+func (r *PostgresRepo) WithTx(fn func(repo Repository) error) error {
+	// Уже внутри транзакции: переиспользуем её, вложенные вызовы остаются атомарными.
+	if r.db == nil {
+		return fn(r)
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(&PostgresRepo{q: tx}); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
 
 func (r *PostgresRepo) GetUserByUsername(username string) (*models.User, error) {
 	var user models.User
-	query := `SELECT id, username, password, coins FROM users WHERE username = $1`
-	err := r.db.QueryRow(query, username).Scan(&user.ID, &user.Username, &user.Password, &user.Coins)
+	query := `SELECT id, username, password, coins, role FROM users WHERE username = $1`
+	err := r.q.QueryRow(query, username).Scan(&user.ID, &user.Username, &user.Password, &user.Coins, &user.Role)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -66,28 +238,42 @@ func (r *PostgresRepo) GetUserByUsername(username string) (*models.User, error)
 func (r *PostgresRepo) CreateUser(username, password string) (int, error) {
 	query := `INSERT INTO users (username, password, coins) VALUES ($1, $2, 1000) RETURNING id`
 	var id int
-	err := r.db.QueryRow(query, username, password).Scan(&id)
+	err := r.q.QueryRow(query, username, password).Scan(&id)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == pqUniqueViolation {
+		return 0, ErrAlreadyExists
+	}
 	return id, err
 }
 
 func (r *PostgresRepo) UpdateUserCoins(userID, newAmount int) error {
 	query := `UPDATE users SET coins = $1 WHERE id = $2`
-	_, err := r.db.Exec(query, newAmount, userID)
+	_, err := r.q.Exec(query, newAmount, userID)
 	return err
 }
 
-func (r *PostgresRepo) InsertCoinTransaction(fromUserID, toUserID *int, amount int) error {
-	query := `INSERT INTO coin_transactions (from_user_id, to_user_id, amount) VALUES ($1, $2, $3)`
-	_, err := r.db.Exec(query, fromUserID, toUserID, amount)
-	return err
+func (r *PostgresRepo) InsertCoinTransaction(t models.CoinTransaction) error {
+	if t.Kind == "" {
+		t.Kind = models.TxTransfer
+	}
+	query := `INSERT INTO coin_transactions (from_user_id, to_user_id, amount, kind, order_id, memo)
+			  VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+	err := r.q.QueryRow(query, t.FromUserID, t.ToUserID, t.Amount, t.Kind, t.OrderID, t.Memo).Scan(&t.ID)
+	if err != nil {
+		return err
+	}
+	return r.insertPostings(t)
 }
 
 func (r *PostgresRepo) GetCoinTransactionsByUserID(userID int) ([]models.CoinTransaction, error) {
-	query := `SELECT id, from_user_id, to_user_id, amount, created_at 
-			  FROM coin_transactions
-			  WHERE from_user_id = $1 OR to_user_id = $1
-			  ORDER BY created_at DESC`
-	rows, err := r.db.Query(query, userID)
+	query := `SELECT t.id, t.from_user_id, t.to_user_id, t.amount, t.kind, t.order_id, t.memo, t.created_at,
+			         fu.username, tu.username
+			  FROM coin_transactions t
+			  LEFT JOIN users fu ON fu.id = t.from_user_id
+			  LEFT JOIN users tu ON tu.id = t.to_user_id
+			  WHERE t.from_user_id = $1 OR t.to_user_id = $1
+			  ORDER BY t.created_at DESC, t.id DESC`
+	rows, err := r.q.Query(query, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -96,25 +282,33 @@ func (r *PostgresRepo) GetCoinTransactionsByUserID(userID int) ([]models.CoinTra
 	var result []models.CoinTransaction
 	for rows.Next() {
 		var c models.CoinTransaction
-		if err := rows.Scan(&c.ID, &c.FromUserID, &c.ToUserID, &c.Amount, &c.CreatedAt); err != nil {
+		if err := rows.Scan(&c.ID, &c.FromUserID, &c.ToUserID, &c.Amount, &c.Kind, &c.OrderID, &c.Memo, &c.CreatedAt,
+			&c.FromUsername, &c.ToUsername); err != nil {
 			return nil, err
 		}
 		result = append(result, c)
 	}
-	return result, nil
+	return result, rows.Err()
 }
 
 func (r *PostgresRepo) InsertItemPurchase(userID int, itemName string, quantity int) error {
 	query := `INSERT INTO item_purchases (user_id, item_name, quantity) VALUES ($1, $2, $3)`
-	_, err := r.db.Exec(query, userID, itemName, quantity)
+	_, err := r.q.Exec(query, userID, itemName, quantity)
 	return err
 }
 
 func (r *PostgresRepo) GetAllPurchasesByUserID(userID int) ([]models.ItemPurchase, error) {
-	query := `SELECT id, user_id, item_name, quantity, created_at 
-			  FROM item_purchases WHERE user_id = $1 
-			  ORDER BY created_at DESC`
-	rows, err := r.db.Query(query, userID)
+	// Позиции отменённых заказов в инвентарь не попадают.
+	query := `SELECT p.id, p.user_id, p.item_name, p.quantity, p.order_id, p.created_at
+			  FROM item_purchases p
+			  LEFT JOIN orders o ON o.id = p.order_id
+			  WHERE p.user_id = $1 AND (o.status IS NULL OR o.status <> 'cancelled')
+			  ORDER BY p.created_at DESC`
+	return r.queryPurchases(query, userID)
+}
+
+func (r *PostgresRepo) queryPurchases(query string, args ...interface{}) ([]models.ItemPurchase, error) {
+	rows, err := r.q.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -123,20 +317,33 @@ func (r *PostgresRepo) GetAllPurchasesByUserID(userID int) ([]models.ItemPurchas
 	var purchases []models.ItemPurchase
 	for rows.Next() {
 		var ip models.ItemPurchase
-		if err := rows.Scan(&ip.ID, &ip.UserID, &ip.ItemName, &ip.Quantity, &ip.CreatedAt); err != nil {
+		if err := rows.Scan(&ip.ID, &ip.UserID, &ip.ItemName, &ip.Quantity, &ip.OrderID, &ip.CreatedAt); err != nil {
 			return nil, err
 		}
 		purchases = append(purchases, ip)
 	}
-	return purchases, nil
+	return purchases, rows.Err()
 }
 
 func (r *PostgresRepo) GetUserByID(userID int) (*models.User, error) {
-	query := `SELECT id, username, password, coins FROM users WHERE id = $1`
-	row := r.db.QueryRow(query, userID)
+	query := `SELECT id, username, password, coins, role FROM users WHERE id = $1`
+	row := r.q.QueryRow(query, userID)
+
+	var user models.User
+	err := row.Scan(&user.ID, &user.Username, &user.Password, &user.Coins, &user.Role)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
 
+func (r *PostgresRepo) GetUserByIDForUpdate(userID int) (*models.User, error) {
+	query := `SELECT id, username, password, coins, role FROM users WHERE id = $1 FOR UPDATE`
 	var user models.User
-	err := row.Scan(&user.ID, &user.Username, &user.Password, &user.Coins)
+	err := r.q.QueryRow(query, userID).Scan(&user.ID, &user.Username, &user.Password, &user.Coins, &user.Role)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -145,3 +352,285 @@ func (r *PostgresRepo) GetUserByID(userID int) (*models.User, error) {
 	}
 	return &user, nil
 }
+
+func (r *PostgresRepo) AddUserCoins(userID, delta int) error {
+	query := `UPDATE users SET coins = coins + $1 WHERE id = $2`
+	_, err := r.q.Exec(query, delta, userID)
+	return mapBalanceErr(err)
+}
+
+func (r *PostgresRepo) DebitUserCoins(userID, amount int) error {
+	query := `UPDATE users SET coins = coins - $1 WHERE id = $2 AND coins >= $1`
+	res, err := r.q.Exec(query, amount, userID)
+	if err != nil {
+		return mapBalanceErr(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrBalanceTooLow
+	}
+	return nil
+}
+
+func mapBalanceErr(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == pqCheckViolation {
+		return ErrBalanceTooLow
+	}
+	return err
+}
+
+func (r *PostgresRepo) GetActiveItems() ([]models.Item, error) {
+	query := `SELECT id, name, title, description, price, stock, active, created_at, updated_at
+			  FROM items WHERE active = TRUE
+			  ORDER BY name`
+	return r.queryItems(query)
+}
+
+func (r *PostgresRepo) GetItemsByNames(names []string) ([]models.Item, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	query := `SELECT id, name, title, description, price, stock, active, created_at, updated_at
+			  FROM items WHERE name = ANY($1)
+			  ORDER BY name`
+	return r.queryItems(query, pq.Array(names))
+}
+
+func (r *PostgresRepo) queryItems(query string, args ...interface{}) ([]models.Item, error) {
+	rows, err := r.q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []models.Item
+	for rows.Next() {
+		var it models.Item
+		if err := rows.Scan(&it.ID, &it.Name, &it.Title, &it.Description, &it.Price, &it.Stock, &it.Active, &it.CreatedAt, &it.UpdatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+func (r *PostgresRepo) GetItemByName(name string) (*models.Item, error) {
+	query := `SELECT id, name, title, description, price, stock, active, created_at, updated_at
+			  FROM items WHERE name = $1`
+	return r.scanItem(r.q.QueryRow(query, name))
+}
+
+func (r *PostgresRepo) GetItemByNameForUpdate(name string) (*models.Item, error) {
+	query := `SELECT id, name, title, description, price, stock, active, created_at, updated_at
+			  FROM items WHERE name = $1 FOR UPDATE`
+	return r.scanItem(r.q.QueryRow(query, name))
+}
+
+func (r *PostgresRepo) scanItem(row *sql.Row) (*models.Item, error) {
+	var it models.Item
+	err := row.Scan(&it.ID, &it.Name, &it.Title, &it.Description, &it.Price, &it.Stock, &it.Active, &it.CreatedAt, &it.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &it, nil
+}
+
+func (r *PostgresRepo) CreateItem(item models.Item) (int, error) {
+	query := `INSERT INTO items (name, title, description, price, stock, active)
+			  VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+	var id int
+	err := r.q.QueryRow(query, item.Name, item.Title, item.Description, item.Price, item.Stock, item.Active).Scan(&id)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == pqUniqueViolation {
+		return 0, ErrAlreadyExists
+	}
+	return id, err
+}
+
+func (r *PostgresRepo) UpdateItem(item *models.Item) error {
+	query := `UPDATE items SET title = $1, description = $2, price = $3, active = $4, updated_at = NOW()
+			  WHERE id = $5 RETURNING updated_at`
+	return r.q.QueryRow(query, item.Title, item.Description, item.Price, item.Active, item.ID).Scan(&item.UpdatedAt)
+}
+
+func (r *PostgresRepo) SetItemStock(item *models.Item) error {
+	query := `UPDATE items SET stock = $1, updated_at = NOW() WHERE id = $2 RETURNING updated_at`
+	return r.q.QueryRow(query, item.Stock, item.ID).Scan(&item.UpdatedAt)
+}
+
+func (r *PostgresRepo) DecrementItemStock(itemID, quantity int) error {
+	query := `UPDATE items SET stock = stock - $1
+			  WHERE id = $2 AND (stock IS NULL OR stock >= $1)`
+	res, err := r.q.Exec(query, quantity, itemID)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == pqCheckViolation {
+			return ErrStockTooLow
+		}
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrStockTooLow
+	}
+	return nil
+}
+
+func (r *PostgresRepo) IncrementItemStock(itemName string, quantity int) error {
+	query := `UPDATE items SET stock = stock + $1 WHERE name = $2 AND stock IS NOT NULL`
+	_, err := r.q.Exec(query, quantity, itemName)
+	return err
+}
+
+// InsertAuditEntry пишет запись аудита; actorUserID = 0 — действие самой
+// системы (например, reconcile), actor_user_id тогда NULL.
+func (r *PostgresRepo) InsertAuditEntry(actorUserID int, action, target, details string) error {
+	var actor interface{}
+	if actorUserID != 0 {
+		actor = actorUserID
+	}
+	query := `INSERT INTO audit_log (actor_user_id, action, target, details) VALUES ($1, $2, $3, $4)`
+	_, err := r.q.Exec(query, actor, action, target, details)
+	return err
+}
+
+func (r *PostgresRepo) GetCartItems(userID int) ([]models.CartItem, error) {
+	query := `SELECT user_id, item_name, quantity, added_at
+			  FROM cart_items WHERE user_id = $1
+			  ORDER BY item_name`
+	return r.queryCartItems(query, userID)
+}
+
+func (r *PostgresRepo) GetCartItemsForUpdate(userID int) ([]models.CartItem, error) {
+	query := `SELECT user_id, item_name, quantity, added_at
+			  FROM cart_items WHERE user_id = $1
+			  ORDER BY item_name FOR UPDATE`
+	return r.queryCartItems(query, userID)
+}
+
+func (r *PostgresRepo) queryCartItems(query string, userID int) ([]models.CartItem, error) {
+	rows, err := r.q.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []models.CartItem
+	for rows.Next() {
+		var ci models.CartItem
+		if err := rows.Scan(&ci.UserID, &ci.ItemName, &ci.Quantity, &ci.AddedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, ci)
+	}
+	return items, rows.Err()
+}
+
+func (r *PostgresRepo) AddCartItem(userID int, itemName string, quantity int) error {
+	query := `INSERT INTO cart_items (user_id, item_name, quantity) VALUES ($1, $2, $3)
+			  ON CONFLICT (user_id, item_name)
+			  DO UPDATE SET quantity = cart_items.quantity + EXCLUDED.quantity`
+	_, err := r.q.Exec(query, userID, itemName, quantity)
+	return err
+}
+
+func (r *PostgresRepo) RemoveCartItem(userID int, itemName string) (bool, error) {
+	query := `DELETE FROM cart_items WHERE user_id = $1 AND item_name = $2`
+	res, err := r.q.Exec(query, userID, itemName)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (r *PostgresRepo) ClearCart(userID int) error {
+	query := `DELETE FROM cart_items WHERE user_id = $1`
+	_, err := r.q.Exec(query, userID)
+	return err
+}
+
+func (r *PostgresRepo) CreateOrder(userID, total int) (int, error) {
+	query := `INSERT INTO orders (user_id, total) VALUES ($1, $2) RETURNING id`
+	var id int
+	err := r.q.QueryRow(query, userID, total).Scan(&id)
+	return id, err
+}
+
+func (r *PostgresRepo) InsertOrderLine(orderID, userID int, itemName string, quantity int) error {
+	query := `INSERT INTO item_purchases (user_id, item_name, quantity, order_id) VALUES ($1, $2, $3, $4)`
+	_, err := r.q.Exec(query, userID, itemName, quantity, orderID)
+	return err
+}
+
+func (r *PostgresRepo) GetOrdersByUserID(userID int) ([]models.Order, error) {
+	query := `SELECT id, user_id, total, status, created_at, updated_at
+			  FROM orders WHERE user_id = $1
+			  ORDER BY created_at DESC, id DESC`
+	return r.queryOrders(query, userID)
+}
+
+func (r *PostgresRepo) GetOrdersByStatus(status string) ([]models.Order, error) {
+	query := `SELECT id, user_id, total, status, created_at, updated_at
+			  FROM orders WHERE $1 = '' OR status = $1
+			  ORDER BY created_at, id`
+	return r.queryOrders(query, status)
+}
+
+func (r *PostgresRepo) queryOrders(query string, args ...interface{}) ([]models.Order, error) {
+	rows, err := r.q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []models.Order
+	for rows.Next() {
+		var o models.Order
+		if err := rows.Scan(&o.ID, &o.UserID, &o.Total, &o.Status, &o.CreatedAt, &o.UpdatedAt); err != nil {
+			return nil, err
+		}
+		orders = append(orders, o)
+	}
+	return orders, rows.Err()
+}
+
+func (r *PostgresRepo) GetOrderByIDForUpdate(orderID int) (*models.Order, error) {
+	query := `SELECT id, user_id, total, status, created_at, updated_at
+			  FROM orders WHERE id = $1 FOR UPDATE`
+	var o models.Order
+	err := r.q.QueryRow(query, orderID).Scan(&o.ID, &o.UserID, &o.Total, &o.Status, &o.CreatedAt, &o.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+func (r *PostgresRepo) UpdateOrderStatus(orderID int, status string) error {
+	query := `UPDATE orders SET status = $1, updated_at = NOW() WHERE id = $2`
+	_, err := r.q.Exec(query, status, orderID)
+	return err
+}
+
+func (r *PostgresRepo) GetOrderLines(orderIDs []int) ([]models.ItemPurchase, error) {
+	if len(orderIDs) == 0 {
+		return nil, nil
+	}
+	query := `SELECT id, user_id, item_name, quantity, order_id, created_at
+			  FROM item_purchases WHERE order_id = ANY($1)
+			  ORDER BY order_id, item_name`
+	return r.queryPurchases(query, pq.Array(orderIDs))
+}
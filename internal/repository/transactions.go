@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	"avito-shop/internal/models"
+)
+
+func (r *PostgresRepo) FindCoinTransactions(f models.TransactionFilter) ([]models.CoinTransaction, error) {
+	var (
+		where []string
+		args  []interface{}
+	)
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	uid := arg(f.UserID)
+	switch f.Direction {
+	case "sent":
+		where = append(where, "t.from_user_id = "+uid)
+		if f.CounterpartyID != nil {
+			where = append(where, "t.to_user_id = "+arg(*f.CounterpartyID))
+		}
+	case "received":
+		where = append(where, "t.to_user_id = "+uid)
+		if f.CounterpartyID != nil {
+			where = append(where, "t.from_user_id = "+arg(*f.CounterpartyID))
+		}
+	default:
+		if f.CounterpartyID != nil {
+			cp := arg(*f.CounterpartyID)
+			where = append(where, fmt.Sprintf(
+				"((t.from_user_id = %[1]s AND t.to_user_id = %[2]s) OR (t.to_user_id = %[1]s AND t.from_user_id = %[2]s))", uid, cp))
+		} else {
+			where = append(where, fmt.Sprintf("(t.from_user_id = %[1]s OR t.to_user_id = %[1]s)", uid))
+		}
+	}
+	if f.Kind != "" {
+		where = append(where, "t.kind = "+arg(f.Kind))
+	}
+	if f.From != nil {
+		where = append(where, "t.created_at >= "+arg(*f.From))
+	}
+	if f.To != nil {
+		where = append(where, "t.created_at < "+arg(*f.To))
+	}
+	if f.AfterCreatedAt != nil {
+		where = append(where, fmt.Sprintf("(t.created_at, t.id) < (%s, %s)", arg(*f.AfterCreatedAt), arg(f.AfterID)))
+	}
+
+	query := `SELECT t.id, t.from_user_id, t.to_user_id, t.amount, t.kind, t.order_id, t.memo, t.created_at,
+			         fu.username, tu.username
+			  FROM coin_transactions t
+			  LEFT JOIN users fu ON fu.id = t.from_user_id
+			  LEFT JOIN users tu ON tu.id = t.to_user_id
+			  WHERE ` + strings.Join(where, " AND ") + `
+			  ORDER BY t.created_at DESC, t.id DESC
+			  LIMIT ` + arg(f.Limit)
+
+	rows, err := r.q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []models.CoinTransaction
+	for rows.Next() {
+		var c models.CoinTransaction
+		if err := rows.Scan(&c.ID, &c.FromUserID, &c.ToUserID, &c.Amount, &c.Kind, &c.OrderID, &c.Memo, &c.CreatedAt,
+			&c.FromUsername, &c.ToUsername); err != nil {
+			return nil, err
+		}
+		result = append(result, c)
+	}
+	return result, rows.Err()
+}
+
+// GetCoinTotalsByCounterparty группирует историю в SQL. Записи без
+// пользователя на второй стороне подписываются системным счётом так же,
+// как в GetInfo: treasury для grant/adjustment/expiry, иначе store.
+// Стартовый баланс (grant), как и в GetInfo, в историю не попадает.
+func (r *PostgresRepo) GetCoinTotalsByCounterparty(userID int) ([]models.CounterpartyTotal, error) {
+	query := `SELECT direction, counterparty, SUM(amount), COUNT(*)
+			  FROM (
+			      SELECT 'received' AS direction, t.amount,
+			             COALESCE(u.username, CASE WHEN t.kind IN ($2, $3, $4) THEN $5 ELSE $6 END) AS counterparty
+			      FROM coin_transactions t
+			      LEFT JOIN users u ON u.id = t.from_user_id
+			      WHERE t.to_user_id = $1 AND t.kind <> $2
+			      UNION ALL
+			      SELECT 'sent' AS direction, t.amount,
+			             COALESCE(u.username, CASE WHEN t.kind IN ($2, $3, $4) THEN $5 ELSE $6 END) AS counterparty
+			      FROM coin_transactions t
+			      LEFT JOIN users u ON u.id = t.to_user_id
+			      WHERE t.from_user_id = $1
+			  ) h
+			  GROUP BY direction, counterparty
+			  ORDER BY direction, SUM(amount) DESC, counterparty`
+	rows, err := r.q.Query(query, userID,
+		models.TxGrant, models.TxAdjustment, models.TxExpiry,
+		models.AccountTreasury, models.AccountStore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []models.CounterpartyTotal
+	for rows.Next() {
+		var c models.CounterpartyTotal
+		if err := rows.Scan(&c.Direction, &c.Counterparty, &c.Amount, &c.Count); err != nil {
+			return nil, err
+		}
+		result = append(result, c)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,257 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"regexp"
+	"strings"
+
+	"avito-shop/internal/models"
+	"avito-shop/internal/repository"
+)
+
+var (
+	ErrItemExists      = errors.New("item already exists")
+	ErrItemNotFound    = errors.New("item not found")
+	ErrInvalidItemName = errors.New("item name must contain only lowercase letters, digits and dashes")
+	ErrInvalidTitle    = errors.New("title must not be empty")
+	ErrInvalidPrice    = errors.New("price must be positive")
+	ErrInvalidStock    = errors.New("stock must not be negative")
+	ErrInvalidRestock  = errors.New("restock quantity must be positive and keep stock within the limit")
+	ErrUnlimitedStock  = errors.New("item has unlimited stock")
+)
+
+var itemNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,63}$`)
+
+// Действия, которые пишутся в audit_log.
+const (
+	auditItemCreate = "item.create"
+	auditItemUpdate = "item.update"
+	auditItemRetire = "item.retire"
+	auditItemStock  = "item.stock"
+	auditUserUnlock = "user.unlock"
+	auditIPUnlock   = "ip.unlock"
+)
+
+// ----------------------------------------
+// CreateItem
+// ----------------------------------------
+
+func (s *service) CreateItem(adminID int, req models.CreateItemRequest) (*models.AdminItem, error) {
+	item := models.Item{
+		Name:        strings.TrimSpace(req.Name),
+		Title:       strings.TrimSpace(req.Title),
+		Description: strings.TrimSpace(req.Description),
+		Price:       req.Price,
+		Stock:       req.Stock,
+		Active:      true,
+	}
+	if !itemNameRe.MatchString(item.Name) {
+		return nil, ErrInvalidItemName
+	}
+	if err := validateItem(item); err != nil {
+		return nil, err
+	}
+
+	var created *models.Item
+	err := s.repo.WithTx(func(repo repository.Repository) error {
+		if _, err := repo.CreateItem(item); err != nil {
+			if err == repository.ErrAlreadyExists {
+				return ErrItemExists
+			}
+			return err
+		}
+		it, err := repo.GetItemByName(item.Name)
+		if err != nil {
+			return err
+		}
+		created = it
+		return writeAudit(repo, adminID, auditItemCreate, item.Name, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.catalog.Invalidate()
+	return toAdminItem(created), nil
+}
+
+// ----------------------------------------
+// UpdateItem
+// ----------------------------------------
+
+func (s *service) UpdateItem(adminID int, name string, req models.UpdateItemRequest) (*models.AdminItem, error) {
+	name = strings.TrimSpace(name)
+
+	var updated *models.Item
+	err := s.repo.WithTx(func(repo repository.Repository) error {
+		item, err := repo.GetItemByNameForUpdate(name)
+		if err != nil {
+			return err
+		}
+		if item == nil {
+			return ErrItemNotFound
+		}
+
+		if req.Title != nil {
+			item.Title = strings.TrimSpace(*req.Title)
+		}
+		if req.Description != nil {
+			item.Description = strings.TrimSpace(*req.Description)
+		}
+		if req.Price != nil {
+			item.Price = *req.Price
+		}
+		if req.Active != nil {
+			item.Active = *req.Active
+		}
+		if err := validateItem(*item); err != nil {
+			return err
+		}
+
+		if err := repo.UpdateItem(item); err != nil {
+			return err
+		}
+		updated = item
+		return writeAudit(repo, adminID, auditItemUpdate, name, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.catalog.Invalidate()
+	return toAdminItem(updated), nil
+}
+
+// ----------------------------------------
+// RetireItem
+// ----------------------------------------
+
+// RetireItem снимает товар с продажи. Строка в items остаётся, чтобы
+// история покупок продолжала ссылаться на существующий товар.
+func (s *service) RetireItem(adminID int, name string) error {
+	name = strings.TrimSpace(name)
+
+	err := s.repo.WithTx(func(repo repository.Repository) error {
+		item, err := repo.GetItemByNameForUpdate(name)
+		if err != nil {
+			return err
+		}
+		if item == nil {
+			return ErrItemNotFound
+		}
+
+		item.Active = false
+		if err := repo.UpdateItem(item); err != nil {
+			return err
+		}
+		return writeAudit(repo, adminID, auditItemRetire, name, nil)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.catalog.Invalidate()
+	return nil
+}
+
+// ----------------------------------------
+// RestockItem / SetItemStock
+// ----------------------------------------
+
+// RestockItem добавляет quantity единиц к ограниченному запасу товара.
+func (s *service) RestockItem(adminID int, name string, quantity int) (*models.AdminItem, error) {
+	if quantity <= 0 {
+		return nil, ErrInvalidRestock
+	}
+	return s.changeStock(adminID, name, func(item *models.Item) error {
+		if item.Stock == nil {
+			return ErrUnlimitedStock
+		}
+		// stock — INT в БД.
+		if quantity > math.MaxInt32-*item.Stock {
+			return ErrInvalidRestock
+		}
+		stock := *item.Stock + quantity
+		item.Stock = &stock
+		return nil
+	}, models.RestockRequest{Quantity: quantity})
+}
+
+// SetItemStock задаёт остаток целиком; nil делает запас неограниченным.
+func (s *service) SetItemStock(adminID int, name string, stock *int) (*models.AdminItem, error) {
+	if stock != nil && *stock < 0 {
+		return nil, ErrInvalidStock
+	}
+	return s.changeStock(adminID, name, func(item *models.Item) error {
+		item.Stock = stock
+		return nil
+	}, models.SetStockRequest{Stock: stock})
+}
+
+func (s *service) changeStock(adminID int, name string, apply func(item *models.Item) error, details interface{}) (*models.AdminItem, error) {
+	name = strings.TrimSpace(name)
+
+	var updated *models.Item
+	err := s.repo.WithTx(func(repo repository.Repository) error {
+		item, err := repo.GetItemByNameForUpdate(name)
+		if err != nil {
+			return err
+		}
+		if item == nil {
+			return ErrItemNotFound
+		}
+		if err := apply(item); err != nil {
+			return err
+		}
+		if err := repo.SetItemStock(item); err != nil {
+			return err
+		}
+		updated = item
+		return writeAudit(repo, adminID, auditItemStock, name, details)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.catalog.Invalidate()
+	return toAdminItem(updated), nil
+}
+
+func validateItem(item models.Item) error {
+	if item.Title == "" {
+		return ErrInvalidTitle
+	}
+	if item.Price <= 0 {
+		return ErrInvalidPrice
+	}
+	if item.Stock != nil && *item.Stock < 0 {
+		return ErrInvalidStock
+	}
+	return nil
+}
+
+func writeAudit(repo repository.Repository, actorID int, action, target string, details interface{}) error {
+	var payload string
+	if details != nil {
+		b, err := json.Marshal(details)
+		if err != nil {
+			return err
+		}
+		payload = string(b)
+	}
+	return repo.InsertAuditEntry(actorID, action, target, payload)
+}
+
+func toAdminItem(it *models.Item) *models.AdminItem {
+	return &models.AdminItem{
+		Name:        it.Name,
+		Title:       it.Title,
+		Description: it.Description,
+		Price:       it.Price,
+		Stock:       it.Stock,
+		Active:      it.Active,
+		UpdatedAt:   it.UpdatedAt,
+	}
+}
@@ -0,0 +1,200 @@
+package service_test
+
+import (
+	"database/sql"
+	"math"
+	"regexp"
+	"testing"
+	"time"
+
+	"avito-shop/internal/config"
+	"avito-shop/internal/models"
+	"avito-shop/internal/repository"
+	"avito-shop/internal/service"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var itemColumns = []string{"id", "name", "title", "description", "price", "stock", "active", "created_at", "updated_at"}
+
+func TestCreateItem_Success(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO items (name, title, description, price, stock, active)`)).
+		WithArgs("sticker", "Стикер", "", 5, nil, true).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(11))
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM items WHERE name = $1`)).
+		WithArgs("sticker").
+		WillReturnRows(sqlmock.NewRows(itemColumns).AddRow(11, "sticker", "Стикер", "", 5, nil, true, now, now))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO audit_log (actor_user_id, action, target, details) VALUES ($1, $2, $3, $4)`)).
+		WithArgs(1, "item.create", "sticker", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	item, err := svc.CreateItem(1, models.CreateItemRequest{Name: "sticker", Title: "Стикер", Price: 5})
+	require.NoError(t, err)
+	assert.Equal(t, "sticker", item.Name)
+	assert.True(t, item.Active)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateItem_Validation(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+
+	_, err = svc.CreateItem(1, models.CreateItemRequest{Name: "Bad Name", Title: "x", Price: 5})
+	assert.ErrorIs(t, err, service.ErrInvalidItemName)
+
+	_, err = svc.CreateItem(1, models.CreateItemRequest{Name: "ok", Title: " ", Price: 5})
+	assert.ErrorIs(t, err, service.ErrInvalidTitle)
+
+	_, err = svc.CreateItem(1, models.CreateItemRequest{Name: "ok", Title: "Ok", Price: 0})
+	assert.ErrorIs(t, err, service.ErrInvalidPrice)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateItem_Duplicate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO items (name, title, description, price, stock, active)`)).
+		WillReturnError(&pq.Error{Code: "23505"})
+	mock.ExpectRollback()
+
+	_, err = svc.CreateItem(1, models.CreateItemRequest{Name: "cup", Title: "Кружка", Price: 20})
+	assert.ErrorIs(t, err, service.ErrItemExists)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateItem_Reprice(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+	now := time.Now()
+	price := 25
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM items WHERE name = $1 FOR UPDATE`)).
+		WithArgs("cup").
+		WillReturnRows(sqlmock.NewRows(itemColumns).AddRow(2, "cup", "Кружка", "", 20, nil, true, now.Add(-time.Hour), now.Add(-time.Hour)))
+	mock.ExpectQuery(regexp.QuoteMeta(`UPDATE items SET title = $1, description = $2, price = $3, active = $4, updated_at = NOW()`)).
+		WithArgs("Кружка", "", 25, true, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"updated_at"}).AddRow(now))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO audit_log`)).
+		WithArgs(1, "item.update", "cup", `{"price":25}`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	item, err := svc.UpdateItem(1, "cup", models.UpdateItemRequest{Price: &price})
+	require.NoError(t, err)
+	assert.Equal(t, 25, item.Price)
+	assert.Equal(t, now, item.UpdatedAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRetireItem_NotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM items WHERE name = $1 FOR UPDATE`)).
+		WithArgs("nothing").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	err = svc.RetireItem(1, "nothing")
+	assert.ErrorIs(t, err, service.ErrItemNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRestockItem_Success(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM items WHERE name = $1 FOR UPDATE`)).
+		WithArgs("pink-hoody").
+		WillReturnRows(sqlmock.NewRows(itemColumns).AddRow(10, "pink-hoody", "Розовое худи", "", 500, 2, true, now, now))
+	mock.ExpectQuery(regexp.QuoteMeta(`UPDATE items SET stock = $1, updated_at = NOW() WHERE id = $2 RETURNING updated_at`)).
+		WithArgs(12, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"updated_at"}).AddRow(now))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO audit_log`)).
+		WithArgs(1, "item.stock", "pink-hoody", `{"quantity":10}`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	item, err := svc.RestockItem(1, "pink-hoody", 10)
+	require.NoError(t, err)
+	require.NotNil(t, item.Stock)
+	assert.Equal(t, 12, *item.Stock)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRestockItem_Overflow(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+	now := time.Now()
+
+	// Остаток не должен выйти за INT колонки stock.
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM items WHERE name = $1 FOR UPDATE`)).
+		WithArgs("pink-hoody").
+		WillReturnRows(sqlmock.NewRows(itemColumns).AddRow(10, "pink-hoody", "Розовое худи", "", 500, 2, true, now, now))
+	mock.ExpectRollback()
+
+	_, err = svc.RestockItem(1, "pink-hoody", math.MaxInt32-1)
+	assert.ErrorIs(t, err, service.ErrInvalidRestock)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRestockItem_UnlimitedStock(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM items WHERE name = $1 FOR UPDATE`)).
+		WithArgs("pen").
+		WillReturnRows(sqlmock.NewRows(itemColumns).AddRow(4, "pen", "Ручка", "", 10, nil, true, now, now))
+	mock.ExpectRollback()
+
+	_, err = svc.RestockItem(1, "pen", 5)
+	assert.ErrorIs(t, err, service.ErrUnlimitedStock)
+
+	_, err = svc.RestockItem(1, "pen", 0)
+	assert.ErrorIs(t, err, service.ErrInvalidRestock)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
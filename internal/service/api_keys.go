@@ -0,0 +1,167 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"avito-shop/internal/models"
+)
+
+var (
+	ErrInvalidAPIKeyName   = errors.New("api key name must be 1-64 characters")
+	ErrInvalidScope        = errors.New("unknown or empty api key scopes")
+	ErrInvalidAPIKeyExpiry = errors.New("api key expiry must be in the future and at most one year ahead")
+	ErrAPIKeyNotFound      = errors.New("api key not found")
+	ErrInvalidAPIKey       = errors.New("invalid or expired api key")
+)
+
+const (
+	// APIKeyPrefix отличает API-ключ от JWT в заголовке Authorization.
+	APIKeyPrefix = "ask_"
+
+	maxAPIKeyNameLength = 64
+	defaultAPIKeyTTL    = 90 * 24 * time.Hour
+	maxAPIKeyTTL        = 365 * 24 * time.Hour
+	// apiKeyPrefixLength — сколько символов ключа (вместе с APIKeyPrefix)
+	// хранится открыто, чтобы ключ можно было узнать в списке.
+	apiKeyPrefixLength = 12
+)
+
+var apiKeyScopes = map[string]bool{
+	models.ScopeInfoRead:  true,
+	models.ScopeCoinsSend: true,
+	models.ScopeItemsBuy:  true,
+}
+
+// ----------------------------------------
+// API keys
+// ----------------------------------------
+
+// CreateAPIKey выпускает ключ. В БД хранится только его sha256; открытый
+// ключ есть лишь в ответе.
+func (s *service) CreateAPIKey(userID int, req models.CreateAPIKeyRequest) (*models.CreatedAPIKey, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len([]rune(name)) > maxAPIKeyNameLength {
+		return nil, ErrInvalidAPIKeyName
+	}
+	scopes, err := normalizeScopes(req.Scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	expiresAt := now.Add(defaultAPIKeyTTL)
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(now) || req.ExpiresAt.Sub(now) > maxAPIKeyTTL {
+			return nil, ErrInvalidAPIKeyExpiry
+		}
+		expiresAt = *req.ExpiresAt
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	secret := APIKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	key := models.APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    secret[:apiKeyPrefixLength],
+		KeyHash:   hashToken(secret),
+		Scopes:    scopes,
+		// expires_at — TIMESTAMP без часового пояса, хранится в UTC.
+		ExpiresAt: expiresAt.UTC(),
+	}
+	if err := s.repo.InsertAPIKey(&key); err != nil {
+		return nil, err
+	}
+	return &models.CreatedAPIKey{APIKeyInfo: apiKeyInfo(key), Key: secret}, nil
+}
+
+func (s *service) ListAPIKeys(userID int) ([]models.APIKeyInfo, error) {
+	keys, err := s.repo.ListAPIKeys(userID)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]models.APIKeyInfo, 0, len(keys))
+	for _, k := range keys {
+		infos = append(infos, apiKeyInfo(k))
+	}
+	return infos, nil
+}
+
+func (s *service) RevokeAPIKey(userID, keyID int) error {
+	revoked, err := s.repo.RevokeAPIKey(userID, keyID)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// AuthenticateAPIKey вызывается JwtMiddleware для заголовка с ключом
+// вместо JWT.
+func (s *service) AuthenticateAPIKey(secret string) (*models.Principal, error) {
+	if !strings.HasPrefix(secret, APIKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+	key, err := s.repo.GetAPIKeyByHash(hashToken(secret))
+	if err != nil {
+		return nil, err
+	}
+	if key == nil || !s.now().Before(key.ExpiresAt) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err := s.repo.TouchAPIKey(key.ID); err != nil {
+		return nil, err
+	}
+	return &models.Principal{
+		UserID:   key.UserID,
+		Username: key.Username,
+		Roles:    []string{key.Role},
+		Scopes:   key.Scopes,
+		TokenID:  "apikey:" + strconv.Itoa(key.ID),
+		APIKeyID: key.ID,
+	}, nil
+}
+
+// normalizeScopes проверяет области и убирает повторы.
+func normalizeScopes(scopes []string) ([]string, error) {
+	seen := make(map[string]bool, len(scopes))
+	out := make([]string, 0, len(scopes))
+	for _, sc := range scopes {
+		sc = strings.TrimSpace(sc)
+		if !apiKeyScopes[sc] {
+			return nil, ErrInvalidScope
+		}
+		if !seen[sc] {
+			seen[sc] = true
+			out = append(out, sc)
+		}
+	}
+	if len(out) == 0 {
+		return nil, ErrInvalidScope
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func apiKeyInfo(k models.APIKey) models.APIKeyInfo {
+	return models.APIKeyInfo{
+		ID:         k.ID,
+		Name:       k.Name,
+		Prefix:     k.Prefix,
+		Scopes:     k.Scopes,
+		ExpiresAt:  k.ExpiresAt,
+		LastUsedAt: k.LastUsedAt,
+		CreatedAt:  k.CreatedAt,
+	}
+}
@@ -0,0 +1,202 @@
+package service_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"avito-shop/internal/config"
+	"avito-shop/internal/models"
+	"avito-shop/internal/repository"
+	"avito-shop/internal/service"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var apiKeyColumns = []string{"id", "user_id", "name", "prefix", "scopes", "expires_at", "last_used_at", "created_at", "username", "role"}
+
+func TestCreateAPIKey(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	clock := newFakeClock()
+	svc := service.NewService(repository.NewRepository(db), &config.Config{JWTSecret: "test-secret"},
+		service.WithClock(clock.Now))
+
+	stored := &captureArg{}
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at)`)).
+		WithArgs(1, "slack-bot", sqlmock.AnyArg(), stored,
+			pq.Array([]string{models.ScopeCoinsSend, models.ScopeInfoRead}), clock.Now().Add(90*24*time.Hour)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(3, clock.Now()))
+
+	key, err := svc.CreateAPIKey(1, models.CreateAPIKeyRequest{
+		Name:   " slack-bot ",
+		Scopes: []string{"info:read", "coins:send", "info:read"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, key.ID)
+	assert.True(t, strings.HasPrefix(key.Key, service.APIKeyPrefix))
+	assert.Equal(t, key.Key[:12], key.Prefix)
+	assert.Equal(t, []string{"coins:send", "info:read"}, key.Scopes)
+	// В БД только хэш.
+	assert.Equal(t, sha(key.Key), stored.value)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateAPIKey_ExpiryInUTC(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	// 15:00 по Москве — 12:00 UTC.
+	msk := time.FixedZone("MSK", 3*60*60)
+	clock := &fakeClock{t: time.Date(2024, 3, 1, 15, 0, 0, 0, msk)}
+	svc := service.NewService(repository.NewRepository(db), &config.Config{JWTSecret: "test-secret"},
+		service.WithClock(clock.Now))
+
+	explicit := time.Date(2024, 4, 1, 3, 0, 0, 0, msk)
+	cases := []struct {
+		expiresAt *time.Time
+		want      time.Time
+	}{
+		{nil, time.Date(2024, 5, 30, 12, 0, 0, 0, time.UTC)},
+		{&explicit, time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at)`)).
+			WithArgs(1, "bot", sqlmock.AnyArg(), sqlmock.AnyArg(), pq.Array([]string{models.ScopeInfoRead}), c.want).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(3, clock.Now()))
+
+		_, err := svc.CreateAPIKey(1, models.CreateAPIKeyRequest{
+			Name:      "bot",
+			Scopes:    []string{"info:read"},
+			ExpiresAt: c.expiresAt,
+		})
+		require.NoError(t, err)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateAPIKey_Validation(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	clock := newFakeClock()
+	svc := service.NewService(repository.NewRepository(db), &config.Config{JWTSecret: "test-secret"},
+		service.WithClock(clock.Now))
+
+	past := clock.Now().Add(-time.Minute)
+	tooFar := clock.Now().Add(400 * 24 * time.Hour)
+	cases := []struct {
+		req  models.CreateAPIKeyRequest
+		want error
+	}{
+		{models.CreateAPIKeyRequest{Name: "", Scopes: []string{"info:read"}}, service.ErrInvalidAPIKeyName},
+		{models.CreateAPIKeyRequest{Name: strings.Repeat("x", 65), Scopes: []string{"info:read"}}, service.ErrInvalidAPIKeyName},
+		{models.CreateAPIKeyRequest{Name: "bot"}, service.ErrInvalidScope},
+		{models.CreateAPIKeyRequest{Name: "bot", Scopes: []string{"admin"}}, service.ErrInvalidScope},
+		{models.CreateAPIKeyRequest{Name: "bot", Scopes: []string{"info:read"}, ExpiresAt: &past}, service.ErrInvalidAPIKeyExpiry},
+		{models.CreateAPIKeyRequest{Name: "bot", Scopes: []string{"info:read"}, ExpiresAt: &tooFar}, service.ErrInvalidAPIKeyExpiry},
+	}
+	for _, c := range cases {
+		_, err := svc.CreateAPIKey(1, c.req)
+		assert.Equal(t, c.want, err, "%+v", c.req)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	clock := newFakeClock()
+	svc := service.NewService(repository.NewRepository(db), &config.Config{JWTSecret: "test-secret"},
+		service.WithClock(clock.Now))
+
+	secret := service.APIKeyPrefix + "secret"
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM api_keys k`)).
+		WithArgs(sha(secret)).
+		WillReturnRows(sqlmock.NewRows(apiKeyColumns).
+			AddRow(3, 1, "bot", "ask_secret", "{coins:send}", clock.Now().Add(time.Hour), nil, clock.Now(), "alice", "employee"))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE api_keys SET last_used_at = NOW()`)).
+		WithArgs(3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	p, err := svc.AuthenticateAPIKey(secret)
+	require.NoError(t, err)
+	assert.Equal(t, &models.Principal{
+		UserID:   1,
+		Username: "alice",
+		Roles:    []string{"employee"},
+		Scopes:   []string{"coins:send"},
+		TokenID:  "apikey:3",
+		APIKeyID: 3,
+	}, p)
+
+	// Истёкший ключ.
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM api_keys k`)).
+		WithArgs(sha(secret)).
+		WillReturnRows(sqlmock.NewRows(apiKeyColumns).
+			AddRow(3, 1, "bot", "ask_secret", "{coins:send}", clock.Now(), nil, clock.Now(), "alice", "employee"))
+	_, err = svc.AuthenticateAPIKey(secret)
+	assert.Equal(t, service.ErrInvalidAPIKey, err)
+
+	// Отозванный или неизвестный.
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM api_keys k`)).
+		WithArgs(sha(secret)).
+		WillReturnRows(sqlmock.NewRows(apiKeyColumns))
+	_, err = svc.AuthenticateAPIKey(secret)
+	assert.Equal(t, service.ErrInvalidAPIKey, err)
+
+	// JWT вместо ключа даже не ищется в БД.
+	_, err = svc.AuthenticateAPIKey("eyJhbGciOi")
+	assert.Equal(t, service.ErrInvalidAPIKey, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListAndRevokeAPIKeys(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{JWTSecret: "test-secret"})
+
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM api_keys WHERE user_id = $1 AND revoked_at IS NULL`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "prefix", "scopes", "expires_at", "last_used_at", "created_at"}))
+	keys, err := svc.ListAPIKeys(1)
+	require.NoError(t, err)
+	assert.NotNil(t, keys)
+	assert.Empty(t, keys)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM api_keys WHERE user_id = $1 AND revoked_at IS NULL`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "prefix", "scopes", "expires_at", "last_used_at", "created_at"}).
+			AddRow(4, 1, "ci", "ask_abcdefgh", "{info:read,items:buy}", now.Add(time.Hour), now, now))
+	keys, err = svc.ListAPIKeys(1)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, []string{"info:read", "items:buy"}, keys[0].Scopes)
+
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE api_keys SET revoked_at = NOW()`)).
+		WithArgs(4, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, svc.RevokeAPIKey(1, 4))
+
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE api_keys SET revoked_at = NOW()`)).
+		WithArgs(4, 2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.Equal(t, service.ErrAPIKeyNotFound, svc.RevokeAPIKey(2, 4))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,251 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"avito-shop/internal/jwtkeys"
+	"avito-shop/internal/models"
+	"avito-shop/internal/repository"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrSessionRevoked      = errors.New("session has been revoked")
+	ErrInvalidToken        = errors.New("invalid token")
+)
+
+const (
+	defaultAccessTokenTTL  = 15 * time.Minute
+	defaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// ----------------------------------------
+// Tokens
+// ----------------------------------------
+
+// issueTokens открывает новую сессию: access-токен плюс первый
+// refresh-токен её цепочки.
+func (s *service) issueTokens(userID int, username, role string) (*models.AuthResponse, error) {
+	var resp *models.AuthResponse
+	err := s.repo.WithTx(func(repo repository.Repository) error {
+		sessionID, tokenVersion, err := repo.CreateAuthSession(userID)
+		if err != nil {
+			return err
+		}
+		resp, err = s.rotate(repo, userID, username, role, sessionID, tokenVersion)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// rotate выпускает пару токенов в уже открытой сессии.
+func (s *service) rotate(repo repository.Repository, userID int, username, role string, sessionID, tokenVersion int) (*models.AuthResponse, error) {
+	refresh, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	// expires_at — TIMESTAMP без часового пояса, хранится в UTC.
+	expiresAt := time.Now().Add(s.refreshTokenTTL()).UTC()
+	if err := repo.InsertRefreshToken(sessionID, userID, hashToken(refresh), expiresAt); err != nil {
+		return nil, err
+	}
+
+	ttl := s.accessTokenTTL()
+	token, err := GenerateJWT(s.keys, models.AccessClaims{
+		UserID:       userID,
+		Username:     username,
+		Role:         role,
+		Scopes:       sessionScopes(role),
+		SessionID:    sessionID,
+		TokenVersion: tokenVersion,
+	}, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return &models.AuthResponse{Token: token, RefreshToken: refresh, ExpiresIn: int(ttl.Seconds())}, nil
+}
+
+// RefreshTokens обменивает refresh-токен на новую пару. Каждый
+// refresh-токен одноразовый; повторное предъявление уже использованного
+// токена означает, что он утёк, и отзывает всю сессию.
+func (s *service) RefreshTokens(refreshToken string) (*models.AuthResponse, error) {
+	if refreshToken == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	var resp *models.AuthResponse
+	reused := false
+	err := s.repo.WithTx(func(repo repository.Repository) error {
+		rt, err := repo.GetRefreshTokenForUpdate(hashToken(refreshToken))
+		if err != nil {
+			return err
+		}
+		if rt == nil || rt.SessionRevoked || time.Now().After(rt.ExpiresAt) {
+			return ErrInvalidRefreshToken
+		}
+		if rt.UsedAt != nil {
+			// Отзыв должен закоммититься, поэтому ошибку вернём после транзакции.
+			reused = true
+			return repo.RevokeAuthSession(rt.UserID, rt.SessionID)
+		}
+
+		if err := repo.MarkRefreshTokenUsed(rt.ID); err != nil {
+			return err
+		}
+		resp, err = s.rotate(repo, rt.UserID, rt.Username, rt.Role, rt.SessionID, rt.TokenVersion)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reused {
+		return nil, ErrInvalidRefreshToken
+	}
+	return resp, nil
+}
+
+// ----------------------------------------
+// Logout
+// ----------------------------------------
+
+// Logout завершает текущую сессию. С everywhere = true отзываются все
+// сессии и API-ключи пользователя, а token_version увеличивается, так что
+// уже выданные access-токены перестают приниматься сразу, не дожидаясь exp.
+func (s *service) Logout(userID, sessionID int, everywhere bool) error {
+	if !everywhere {
+		return s.repo.RevokeAuthSession(userID, sessionID)
+	}
+	return s.repo.WithTx(func(repo repository.Repository) error {
+		if err := repo.BumpTokenVersion(userID); err != nil {
+			return err
+		}
+		if err := repo.RevokeAllAuthSessions(userID); err != nil {
+			return err
+		}
+		return repo.RevokeAllAPIKeys(userID)
+	})
+}
+
+// CheckSession вызывается JwtMiddleware на каждый запрос: access-токен
+// отозванной сессии или устаревшей token_version не принимается.
+func (s *service) CheckSession(userID, sessionID, tokenVersion int) error {
+	active, err := s.repo.IsSessionActive(userID, sessionID, tokenVersion)
+	if err != nil {
+		return err
+	}
+	if !active {
+		return ErrSessionRevoked
+	}
+	return nil
+}
+
+// ParseAccessToken проверяет подпись и срок access-токена ключами сервиса
+// и достаёт из него claims. Отзыв сессии здесь не проверяется — см.
+// CheckSession.
+func (s *service) ParseAccessToken(tokenString string) (*models.AccessClaims, error) {
+	claims := jwt.MapClaims{}
+	token, err := s.keys.Parse(tokenString, claims)
+	if err != nil || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	// Служебные токены (например, mfa) подписаны теми же ключами, но
+	// доступа к API не дают.
+	if _, ok := claims["purpose"]; ok {
+		return nil, ErrInvalidToken
+	}
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	role, _ := claims["role"].(string)
+	if role == "" {
+		role = models.RoleEmployee
+	}
+	// Токены, выпущенные до появления scope, получают области своей роли.
+	scopes := sessionScopes(role)
+	if scope, ok := claims["scope"].(string); ok {
+		scopes = strings.Fields(scope)
+	}
+	username, _ := claims["username"].(string)
+	jti, _ := claims["jti"].(string)
+	sessionID, _ := claims["sid"].(float64)
+	tokenVersion, _ := claims["tv"].(float64)
+	return &models.AccessClaims{
+		UserID:       int(userID),
+		Username:     username,
+		Role:         role,
+		Scopes:       scopes,
+		SessionID:    int(sessionID),
+		TokenVersion: int(tokenVersion),
+		TokenID:      jti,
+	}, nil
+}
+
+// sessionScopes — области access-токена интерактивной сессии: всё, что
+// разрешено роли.
+func sessionScopes(role string) []string {
+	scopes := []string{models.ScopeInfoRead, models.ScopeCoinsSend, models.ScopeItemsBuy, models.ScopeAccount}
+	if role == models.RoleAdmin {
+		scopes = append(scopes, models.ScopeAdmin)
+	}
+	return scopes
+}
+
+// JWKS — публичные ключи проверки токенов для других сервисов.
+func (s *service) JWKS() jwtkeys.JWKS {
+	return s.keys.JWKS()
+}
+
+// PurgeExpiredRefreshTokens удаляет refresh-токены с истёкшим сроком.
+func (s *service) PurgeExpiredRefreshTokens() (int64, error) {
+	return s.repo.DeleteExpiredRefreshTokens()
+}
+
+func (s *service) accessTokenTTL() time.Duration {
+	if s.cfg.AccessTokenTTL > 0 {
+		return s.cfg.AccessTokenTTL
+	}
+	return defaultAccessTokenTTL
+}
+
+func (s *service) refreshTokenTTL() time.Duration {
+	if s.cfg.RefreshTokenTTL > 0 {
+		return s.cfg.RefreshTokenTTL
+	}
+	return defaultRefreshTokenTTL
+}
+
+// newRefreshToken — 32 случайных байта в base64url.
+func newRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// newTokenID — jti access-токена.
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashToken — в БД хранится только sha256 от токена.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
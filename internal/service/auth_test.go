@@ -0,0 +1,251 @@
+package service_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"testing"
+	"time"
+
+	"avito-shop/internal/config"
+	"avito-shop/internal/jwtkeys"
+	"avito-shop/internal/models"
+	"avito-shop/internal/repository"
+	"avito-shop/internal/service"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var refreshColumns = []string{"id", "session_id", "user_id", "token_hash", "expires_at", "used_at", "revoked", "role", "token_version", "username"}
+
+// expectSession — выпуск новой сессии после успешного входа.
+func expectSession(mock sqlmock.Sqlmock, userID, sessionID int) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO auth_sessions (user_id) VALUES ($1)`)).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "token_version"}).AddRow(sessionID, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO refresh_tokens (session_id, user_id, token_hash, expires_at)`)).
+		WithArgs(sessionID, userID, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+func sha(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestGenerateJWT_Claims(t *testing.T) {
+	token, err := service.GenerateJWT(jwtkeys.HMAC("test-secret"), models.AccessClaims{
+		UserID:       1,
+		Username:     "root",
+		Role:         "admin",
+		Scopes:       []string{"info:read", "admin"},
+		SessionID:    7,
+		TokenVersion: 2,
+	}, 5*time.Minute)
+	require.NoError(t, err)
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		return []byte("test-secret"), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, float64(1), claims["user_id"])
+	assert.Equal(t, float64(7), claims["sid"])
+	assert.Equal(t, float64(2), claims["tv"])
+	assert.Equal(t, "root", claims["username"])
+	assert.Equal(t, "info:read admin", claims["scope"])
+	assert.NotEmpty(t, claims["jti"])
+	assert.InDelta(t, time.Now().Add(5*time.Minute).Unix(), claims["exp"], 5)
+}
+
+func TestParseAccessToken_Principal(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{JWTSecret: "test-secret"})
+
+	// Токен сессии несёт имя, jti и все области роли.
+	hash, _ := bcrypt.GenerateFromPassword([]byte("right"), bcrypt.MinCost)
+	expectUserByName(mock, "alice", string(hash))
+	expectNoTOTP(mock, 1)
+	expectSession(mock, 1, 3)
+	resp, err := svc.AuthUser("alice", "right", "")
+	require.NoError(t, err)
+
+	claims, err := svc.ParseAccessToken(resp.Token)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", claims.Username)
+	assert.Equal(t, 3, claims.SessionID)
+	assert.NotEmpty(t, claims.TokenID)
+	assert.ElementsMatch(t, []string{"info:read", "coins:send", "items:buy", "account"}, claims.Scopes)
+
+	// Токен без scope (выпущен до его появления) получает области роли.
+	legacy, err := jwtkeys.HMAC("test-secret").Sign(jwt.MapClaims{
+		"user_id": 2, "role": "admin", "sid": 1, "tv": 0, "exp": time.Now().Add(time.Minute).Unix(),
+	})
+	require.NoError(t, err)
+	claims, err = svc.ParseAccessToken(legacy)
+	require.NoError(t, err)
+	assert.Contains(t, claims.Scopes, models.ScopeAdmin)
+	assert.Contains(t, claims.Scopes, models.ScopeAccount)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRefreshTokens_Rotates(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{JWTSecret: "test-secret"})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM refresh_tokens t`)).
+		WithArgs(sha("old-token")).
+		WillReturnRows(sqlmock.NewRows(refreshColumns).
+			AddRow(5, 7, 1, sha("old-token"), time.Now().Add(time.Hour), nil, false, "employee", 2, "alice"))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE refresh_tokens SET used_at = NOW() WHERE id = $1`)).
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expiresAt := &captureArg{}
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO refresh_tokens (session_id, user_id, token_hash, expires_at)`)).
+		WithArgs(7, 1, sqlmock.AnyArg(), expiresAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	resp, err := svc.RefreshTokens("old-token")
+	require.NoError(t, err)
+	assert.NotEmpty(t, resp.Token)
+	assert.NotEqual(t, "old-token", resp.RefreshToken)
+	assert.Equal(t, 15*60, resp.ExpiresIn)
+
+	// Срок пишется в UTC: колонка без часового пояса.
+	stored, ok := expiresAt.value.(time.Time)
+	require.True(t, ok)
+	assert.Equal(t, time.UTC, stored.Location())
+	assert.WithinDuration(t, time.Now().Add(30*24*time.Hour), stored, time.Minute)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRefreshTokens_ReuseRevokesSession(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{JWTSecret: "test-secret"})
+
+	usedAt := time.Now().Add(-time.Minute)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM refresh_tokens t`)).
+		WithArgs(sha("stolen")).
+		WillReturnRows(sqlmock.NewRows(refreshColumns).
+			AddRow(5, 7, 1, sha("stolen"), time.Now().Add(time.Hour), usedAt, false, "employee", 0, "alice"))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE auth_sessions SET revoked_at = NOW()`)).
+		WithArgs(7, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	_, err = svc.RefreshTokens("stolen")
+	assert.Equal(t, service.ErrInvalidRefreshToken, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRefreshTokens_Invalid(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{JWTSecret: "test-secret"})
+
+	_, err = svc.RefreshTokens("")
+	assert.Equal(t, service.ErrInvalidRefreshToken, err)
+
+	// Неизвестный токен
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM refresh_tokens t`)).
+		WithArgs(sha("unknown")).
+		WillReturnRows(sqlmock.NewRows(refreshColumns))
+	mock.ExpectRollback()
+
+	_, err = svc.RefreshTokens("unknown")
+	assert.Equal(t, service.ErrInvalidRefreshToken, err)
+
+	// Истёкший токен
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM refresh_tokens t`)).
+		WithArgs(sha("expired")).
+		WillReturnRows(sqlmock.NewRows(refreshColumns).
+			AddRow(5, 7, 1, sha("expired"), time.Now().Add(-time.Hour), nil, false, "employee", 0, "alice"))
+	mock.ExpectRollback()
+
+	_, err = svc.RefreshTokens("expired")
+	assert.Equal(t, service.ErrInvalidRefreshToken, err)
+
+	// Сессия отозвана logout'ом
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM refresh_tokens t`)).
+		WithArgs(sha("logged-out")).
+		WillReturnRows(sqlmock.NewRows(refreshColumns).
+			AddRow(5, 7, 1, sha("logged-out"), time.Now().Add(time.Hour), nil, true, "employee", 0, "alice"))
+	mock.ExpectRollback()
+
+	_, err = svc.RefreshTokens("logged-out")
+	assert.Equal(t, service.ErrInvalidRefreshToken, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLogout(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE auth_sessions SET revoked_at = NOW()
+			  WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`)).
+		WithArgs(7, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, svc.Logout(1, 7, false))
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET token_version = token_version + 1 WHERE id = $1`)).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE auth_sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`)).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE api_keys SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`)).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	require.NoError(t, svc.Logout(1, 7, true))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCheckSession(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT EXISTS`)).
+		WithArgs(7, 1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	assert.NoError(t, svc.CheckSession(1, 7, 2))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT EXISTS`)).
+		WithArgs(7, 1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	assert.Equal(t, service.ErrSessionRevoked, svc.CheckSession(1, 7, 1))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
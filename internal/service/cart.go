@@ -0,0 +1,172 @@
+package service
+
+import (
+	"errors"
+	"math"
+	"strings"
+
+	"avito-shop/internal/models"
+	"avito-shop/internal/repository"
+)
+
+var (
+	ErrCartEmpty        = errors.New("cart is empty")
+	ErrCartItemNotFound = errors.New("item is not in the cart")
+)
+
+// ----------------------------------------
+// Cart
+// ----------------------------------------
+
+func (s *service) GetCart(userID int) (*models.CartResponse, error) {
+	items, err := s.repo.GetCartItems(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &models.CartResponse{Items: make([]models.CartLine, 0, len(items))}
+	for _, ci := range items {
+		line := models.CartLine{Item: ci.ItemName, Quantity: ci.Quantity}
+		// Снятый с продажи товар остаётся в корзине без цены: при checkout
+		// он вернёт ErrInvalidItem, пока пользователь его не удалит.
+		item, ok, err := s.catalog.Lookup(ci.ItemName)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			line.Title = item.Title
+			line.Price = item.Price
+			line.Subtotal = item.Price * ci.Quantity
+		}
+		resp.Items = append(resp.Items, line)
+		resp.Total += line.Subtotal
+	}
+	return resp, nil
+}
+
+func (s *service) AddToCart(userID int, itemName string, quantity int) error {
+	if quantity <= 0 {
+		return ErrInvalidQuantity
+	}
+	itemName = strings.TrimSpace(itemName)
+	_, ok, err := s.catalog.Lookup(itemName)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidItem
+	}
+	return s.repo.AddCartItem(userID, itemName, quantity)
+}
+
+func (s *service) RemoveFromCart(userID int, itemName string) error {
+	removed, err := s.repo.RemoveCartItem(userID, strings.TrimSpace(itemName))
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return ErrCartItemNotFound
+	}
+	return nil
+}
+
+func (s *service) ClearCart(userID int) error {
+	return s.repo.ClearCart(userID)
+}
+
+// ----------------------------------------
+// Checkout
+// ----------------------------------------
+
+// Checkout оплачивает всю корзину одним заказом: либо списываются монеты
+// и остатки по всем позициям, либо не меняется ничего.
+func (s *service) Checkout(userID int) (*models.CheckoutResponse, error) {
+	var resp models.CheckoutResponse
+	err := s.repo.WithTx(func(repo repository.Repository) error {
+		lines, err := repo.GetCartItemsForUpdate(userID)
+		if err != nil {
+			return err
+		}
+		if len(lines) == 0 {
+			return ErrCartEmpty
+		}
+
+		// Строки корзины отсортированы по item_name, поэтому товары
+		// блокируются в одном порядке во всех параллельных checkout.
+		var total int64
+		items := make([]*models.Item, len(lines))
+		for i, line := range lines {
+			item, err := lockItem(repo, line.ItemName)
+			if err != nil {
+				return err
+			}
+			items[i] = item
+			total += int64(item.Price) * int64(line.Quantity)
+			if total > math.MaxInt32 {
+				return ErrQuantityTooLarge
+			}
+		}
+
+		for i, line := range lines {
+			if err := repo.DecrementItemStock(items[i].ID, line.Quantity); err != nil {
+				if err == repository.ErrStockTooLow {
+					return ErrOutOfStock
+				}
+				return err
+			}
+		}
+
+		if err := repo.DebitUserCoins(userID, int(total)); err != nil {
+			if err == repository.ErrBalanceTooLow {
+				return ErrNotEnoughCoins
+			}
+			return err
+		}
+
+		orderID, err := repo.CreateOrder(userID, int(total))
+		if err != nil {
+			return err
+		}
+		for _, line := range lines {
+			if err := repo.InsertOrderLine(orderID, userID, line.ItemName, line.Quantity); err != nil {
+				return err
+			}
+		}
+		if err := repo.InsertCoinTransaction(purchaseTx(userID, orderID, int(total))); err != nil {
+			return err
+		}
+		if err := repo.ClearCart(userID); err != nil {
+			return err
+		}
+
+		resp = models.CheckoutResponse{OrderID: orderID, Total: int(total)}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// lockItem читает товар под блокировкой до конца транзакции: цена и
+// активность на момент покупки, а не из кэша каталога.
+func lockItem(repo repository.Repository, name string) (*models.Item, error) {
+	item, err := repo.GetItemByNameForUpdate(name)
+	if err != nil {
+		return nil, err
+	}
+	if item == nil || !item.Active {
+		return nil, ErrInvalidItem
+	}
+	return item, nil
+}
+
+// purchaseTx — запись журнала о списании монет за заказ.
+func purchaseTx(userID, orderID, amount int) models.CoinTransaction {
+	return models.CoinTransaction{
+		FromUserID: &userID,
+		Amount:     amount,
+		Kind:       models.TxPurchase,
+		OrderID:    &orderID,
+	}
+}
@@ -0,0 +1,175 @@
+package service_test
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"avito-shop/internal/config"
+	"avito-shop/internal/repository"
+	"avito-shop/internal/service"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var cartColumns = []string{"user_id", "item_name", "quantity", "added_at"}
+
+func TestAddToCart_UnknownItem(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+
+	expectCatalog(mock)
+
+	err = svc.AddToCart(1, "yacht", 1)
+	assert.ErrorIs(t, err, service.ErrInvalidItem)
+
+	err = svc.AddToCart(1, "cup", 0)
+	assert.ErrorIs(t, err, service.ErrInvalidQuantity)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetCart_PricesFromCatalog(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+	now := time.Now()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM cart_items WHERE user_id = $1`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(cartColumns).
+			AddRow(1, "cup", 3, now).
+			AddRow(1, "t-shirt", 1, now))
+	expectCatalog(mock)
+
+	cart, err := svc.GetCart(1)
+	require.NoError(t, err)
+	require.Len(t, cart.Items, 2)
+	assert.Equal(t, 60, cart.Items[0].Subtotal)
+	assert.Equal(t, 140, cart.Total)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCheckout_Success(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM cart_items WHERE user_id = $1
+			  ORDER BY item_name FOR UPDATE`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(cartColumns).
+			AddRow(1, "cup", 2, now).
+			AddRow(1, "t-shirt", 1, now))
+	expectLockedItem(mock, 1, "cup", 20, true)
+	expectLockedItem(mock, 2, "t-shirt", 80, true)
+
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE items SET stock = stock - $1`)).
+		WithArgs(2, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE items SET stock = stock - $1`)).
+		WithArgs(1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET coins = coins - $1 WHERE id = $2 AND coins >= $1`)).
+		WithArgs(120, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO orders (user_id, total) VALUES ($1, $2) RETURNING id`)).
+		WithArgs(1, 120).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO item_purchases (user_id, item_name, quantity, order_id) VALUES ($1, $2, $3, $4)`)).
+		WithArgs(1, "cup", 2, 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO item_purchases (user_id, item_name, quantity, order_id) VALUES ($1, $2, $3, $4)`)).
+		WithArgs(1, "t-shirt", 1, 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO coin_transactions (from_user_id, to_user_id, amount, kind, order_id, memo)`)).
+		WithArgs(1, nil, 120, "purchase", 7, "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(42))
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO ledger_postings (transaction_id, user_id, system_account, amount)`)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM cart_items WHERE user_id = $1`)).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	resp, err := svc.Checkout(1)
+	require.NoError(t, err)
+	assert.Equal(t, 7, resp.OrderID)
+	assert.Equal(t, 120, resp.Total)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCheckout_NotEnoughCoinsRollsBack(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM cart_items WHERE user_id = $1`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(cartColumns).AddRow(1, "cup", 2, now))
+	expectLockedItem(mock, 1, "cup", 20, true)
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE items SET stock = stock - $1`)).
+		WithArgs(2, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET coins = coins - $1 WHERE id = $2 AND coins >= $1`)).
+		WithArgs(40, 1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	_, err = svc.Checkout(1)
+	assert.ErrorIs(t, err, service.ErrNotEnoughCoins)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCheckout_RetiredItem(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM cart_items WHERE user_id = $1`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(cartColumns).AddRow(1, "cup", 2, time.Now()))
+	expectLockedItem(mock, 1, "cup", 20, false)
+	mock.ExpectRollback()
+
+	_, err = svc.Checkout(1)
+	assert.ErrorIs(t, err, service.ErrInvalidItem)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCheckout_EmptyCart(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM cart_items WHERE user_id = $1`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(cartColumns))
+	mock.ExpectRollback()
+
+	_, err = svc.Checkout(1)
+	assert.ErrorIs(t, err, service.ErrCartEmpty)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
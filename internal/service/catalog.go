@@ -0,0 +1,85 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"avito-shop/internal/models"
+	"avito-shop/internal/repository"
+)
+
+const defaultCatalogTTL = time.Minute
+
+// catalog — кэш активных товаров из таблицы items. Перечитывается из БД,
+// когда истёк ttl или кэш был явно сброшен.
+type catalog struct {
+	repo repository.Repository
+	ttl  time.Duration
+
+	mu       sync.RWMutex
+	items    []models.Item
+	byName   map[string]models.Item
+	loadedAt time.Time
+}
+
+func newCatalog(repo repository.Repository, ttl time.Duration) *catalog {
+	if ttl <= 0 {
+		ttl = defaultCatalogTTL
+	}
+	return &catalog{repo: repo, ttl: ttl}
+}
+
+// Lookup возвращает активный товар по имени.
+func (c *catalog) Lookup(name string) (models.Item, bool, error) {
+	if err := c.ensureFresh(); err != nil {
+		return models.Item{}, false, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	it, ok := c.byName[name]
+	return it, ok, nil
+}
+
+// List возвращает все активные товары, отсортированные по имени.
+func (c *catalog) List() ([]models.Item, error) {
+	if err := c.ensureFresh(); err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	items := make([]models.Item, len(c.items))
+	copy(items, c.items)
+	return items, nil
+}
+
+// Invalidate сбрасывает кэш; следующий запрос перечитает каталог из БД.
+func (c *catalog) Invalidate() {
+	c.mu.Lock()
+	c.loadedAt = time.Time{}
+	c.mu.Unlock()
+}
+
+func (c *catalog) ensureFresh() error {
+	c.mu.RLock()
+	fresh := !c.loadedAt.IsZero() && time.Since(c.loadedAt) < c.ttl
+	c.mu.RUnlock()
+	if fresh {
+		return nil
+	}
+
+	items, err := c.repo.GetActiveItems()
+	if err != nil {
+		return err
+	}
+	byName := make(map[string]models.Item, len(items))
+	for _, it := range items {
+		byName[it.Name] = it
+	}
+
+	c.mu.Lock()
+	c.items = items
+	c.byName = byName
+	c.loadedAt = time.Now()
+	c.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,39 @@
+package service_test
+
+import (
+	"testing"
+
+	"avito-shop/internal/config"
+	"avito-shop/internal/repository"
+	"avito-shop/internal/service"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListItems_CachedWithinTTL(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := repository.NewRepository(db)
+	cfg := &config.Config{}
+	svc := service.NewService(repo, cfg)
+
+	// Каталог читается из БД один раз, второй вызов обслуживается из кэша
+	expectCatalog(mock)
+
+	items, err := svc.ListItems()
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, "cup", items[0].Name)
+	assert.Equal(t, 20, items[0].Price)
+	assert.Equal(t, "Футболка", items[1].Title)
+
+	items, err = svc.ListItems()
+	require.NoError(t, err)
+	assert.Len(t, items, 2)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
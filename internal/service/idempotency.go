@@ -0,0 +1,129 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"avito-shop/internal/models"
+	"avito-shop/internal/repository"
+)
+
+var (
+	ErrInvalidIdempotencyKey = errors.New("invalid idempotency key")
+	ErrIdempotencyKeyReused  = errors.New("idempotency key was already used for a different request")
+)
+
+const (
+	maxIdempotencyKeyLength = 255
+	defaultIdempotencyTTL   = 24 * time.Hour
+)
+
+// errIdempotentOpFailed откатывает транзакцию, если операция вернула
+// ошибку: частичные изменения внутри неё не должны сохраниться.
+var errIdempotentOpFailed = errors.New("idempotent operation failed")
+
+// ----------------------------------------
+// Idempotent
+// ----------------------------------------
+
+// Idempotent выполняет op не более одного раза для пары (userID, key).
+// Ответ на успешную операцию сохраняется в той же транзакции, что и движение
+// монет; повтор с тем же ключом возвращает сохранённый ответ и replayed = true.
+// fingerprint описывает сам запрос: тот же ключ с другим fingerprint —
+// ErrIdempotencyKeyReused.
+//
+// op получает Service, привязанный к транзакции, и должен выполнять все
+// изменения через него; ошибка op откатывает их. render строит ответ по
+// итогу op (nil — успех) и решает, запоминать ли его: отказы (нехватка
+// монет и т. п.) запоминаются, сбои — нет, чтобы клиент мог повторить запрос.
+func (s *service) Idempotent(userID int, key, fingerprint string, op func(svc Service) error, render func(opErr error) (resp models.IdempotentResponse, store bool)) (*models.IdempotentResponse, bool, error) {
+	if key == "" || len(key) > maxIdempotencyKeyLength {
+		return nil, false, ErrInvalidIdempotencyKey
+	}
+	ttl := s.cfg.IdempotencyTTL
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	expiresAt := time.Now().Add(ttl)
+
+	var (
+		result   models.IdempotentResponse
+		opErr    error
+		replayed bool
+	)
+	err := s.repo.WithTx(func(repo repository.Repository) error {
+		stored, err := reserveOrReplay(repo, userID, key, fingerprint, expiresAt)
+		if err != nil {
+			return err
+		}
+		if stored != nil {
+			result, replayed = *stored, true
+			return nil
+		}
+
+		if opErr = op(s.withRepo(repo)); opErr != nil {
+			return errIdempotentOpFailed
+		}
+		result, _ = render(nil)
+		return repo.SaveIdempotentResponse(userID, key, result.StatusCode, result.Body)
+	})
+	if err == errIdempotentOpFailed {
+		var store bool
+		result, store = render(opErr)
+		if !store {
+			return &result, false, nil
+		}
+		err = s.repo.WithTx(func(repo repository.Repository) error {
+			stored, err := reserveOrReplay(repo, userID, key, fingerprint, expiresAt)
+			if err != nil {
+				return err
+			}
+			if stored != nil {
+				result, replayed = *stored, true
+				return nil
+			}
+			return repo.SaveIdempotentResponse(userID, key, result.StatusCode, result.Body)
+		})
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &result, replayed, nil
+}
+
+// PurgeExpiredIdempotencyKeys удаляет ключи с истёкшим сроком хранения.
+func (s *service) PurgeExpiredIdempotencyKeys() (int64, error) {
+	return s.repo.DeleteExpiredIdempotencyKeys()
+}
+
+// reserveOrReplay занимает ключ или, если он уже использован, возвращает
+// сохранённый ответ.
+func reserveOrReplay(repo repository.Repository, userID int, key, fingerprint string, expiresAt time.Time) (*models.IdempotentResponse, error) {
+	reserved, err := repo.ReserveIdempotencyKey(userID, key, fingerprint, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	if reserved {
+		return nil, nil
+	}
+
+	stored, err := repo.GetIdempotencyKey(userID, key)
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil {
+		return nil, errors.New("idempotency key disappeared")
+	}
+	if stored.Fingerprint != fingerprint {
+		return nil, ErrIdempotencyKeyReused
+	}
+	return &models.IdempotentResponse{StatusCode: stored.StatusCode, Body: stored.ResponseBody}, nil
+}
+
+// withRepo возвращает копию сервиса, работающую через repo (обычно —
+// репозиторий, привязанный к транзакции). Кэш каталога общий.
+func (s *service) withRepo(repo repository.Repository) *service {
+	c := *s
+	c.repo = repo
+	return &c
+}
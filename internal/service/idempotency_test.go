@@ -0,0 +1,167 @@
+package service_test
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"avito-shop/internal/config"
+	"avito-shop/internal/models"
+	"avito-shop/internal/repository"
+	"avito-shop/internal/service"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var idempotencyColumns = []string{"user_id", "idem_key", "fingerprint", "status_code", "response_body", "created_at", "expires_at"}
+
+// render — упрощённое отображение итога операции, как в обработчиках:
+// отказы сервиса запоминаются, прочие ошибки — сбой.
+func render(err error) (models.IdempotentResponse, bool) {
+	switch err {
+	case nil:
+		return models.IdempotentResponse{StatusCode: 200}, true
+	case service.ErrNotEnoughCoins:
+		return models.IdempotentResponse{StatusCode: 400, Body: []byte(`{"errors":"not enough coins"}`)}, true
+	default:
+		return models.IdempotentResponse{StatusCode: 400}, false
+	}
+}
+
+func TestIdempotent_FirstRequestStoresResponse(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{IdempotencyTTL: time.Hour})
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO idempotency_keys (user_id, idem_key, fingerprint, expires_at)`)).
+		WithArgs(1, "key-1", "fp", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE idempotency_keys SET status_code = $1, response_body = $2`)).
+		WithArgs(200, []byte(nil), 1, "key-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	calls := 0
+	resp, replayed, err := svc.Idempotent(1, "key-1", "fp", func(svc service.Service) error {
+		calls++
+		return nil
+	}, render)
+	require.NoError(t, err)
+	assert.False(t, replayed)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, 1, calls)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIdempotent_ReplayDoesNotExecute(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO idempotency_keys`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM idempotency_keys WHERE user_id = $1 AND idem_key = $2`)).
+		WithArgs(1, "key-1").
+		WillReturnRows(sqlmock.NewRows(idempotencyColumns).
+			AddRow(1, "key-1", "fp", 200, nil, now, now.Add(time.Hour)))
+	mock.ExpectCommit()
+
+	resp, replayed, err := svc.Idempotent(1, "key-1", "fp", func(svc service.Service) error {
+		t.Fatal("operation must not run on replay")
+		return nil
+	}, render)
+	require.NoError(t, err)
+	assert.True(t, replayed)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIdempotent_KeyReusedForDifferentRequest(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO idempotency_keys`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM idempotency_keys WHERE user_id = $1 AND idem_key = $2`)).
+		WithArgs(1, "key-1").
+		WillReturnRows(sqlmock.NewRows(idempotencyColumns).
+			AddRow(1, "key-1", "other", 200, nil, now, now.Add(time.Hour)))
+	mock.ExpectRollback()
+
+	_, _, err = svc.Idempotent(1, "key-1", "fp", func(svc service.Service) error {
+		return nil
+	}, render)
+	assert.ErrorIs(t, err, service.ErrIdempotencyKeyReused)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIdempotent_ClientErrorStoredAfterRollback(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+	body := []byte(`{"errors":"not enough coins"}`)
+
+	// Первая транзакция откатывается вместе с частичными изменениями операции
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO idempotency_keys`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectRollback()
+
+	// Отказ запоминается отдельной транзакцией
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO idempotency_keys`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE idempotency_keys SET status_code = $1, response_body = $2`)).
+		WithArgs(400, body, 1, "key-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	resp, replayed, err := svc.Idempotent(1, "key-1", "fp", func(svc service.Service) error {
+		return service.ErrNotEnoughCoins
+	}, render)
+	require.NoError(t, err)
+	assert.False(t, replayed)
+	assert.Equal(t, 400, resp.StatusCode)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIdempotent_FailureNotStored(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO idempotency_keys`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectRollback()
+
+	resp, _, err := svc.Idempotent(1, "key-1", "fp", func(svc service.Service) error {
+		return errors.New("connection reset")
+	}, render)
+	require.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+
+	_, _, err = svc.Idempotent(1, "", "fp", nil, nil)
+	assert.ErrorIs(t, err, service.ErrInvalidIdempotencyKey)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
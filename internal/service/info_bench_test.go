@@ -0,0 +1,94 @@
+package service_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"avito-shop/internal/config"
+	"avito-shop/internal/models"
+	"avito-shop/internal/repository"
+	"avito-shop/internal/service"
+)
+
+// historyRepo — репозиторий в памяти для GetInfo, считающий обращения.
+// Методы, которые GetInfo вызывать не должен, паникуют через nil-интерфейс.
+type historyRepo struct {
+	repository.Repository
+	user    models.User
+	history []models.CoinTransaction
+	queries int
+}
+
+func (r *historyRepo) GetUserByID(id int) (*models.User, error) {
+	r.queries++
+	if id != r.user.ID {
+		return nil, nil
+	}
+	u := r.user
+	return &u, nil
+}
+
+func (r *historyRepo) GetAllPurchasesByUserID(userID int) ([]models.ItemPurchase, error) {
+	r.queries++
+	return nil, nil
+}
+
+func (r *historyRepo) GetCoinTransactionsByUserID(userID int) ([]models.CoinTransaction, error) {
+	r.queries++
+	return r.history, nil
+}
+
+func newHistoryRepo(n int) *historyRepo {
+	alice := "alice"
+	r := &historyRepo{user: models.User{ID: 1, Username: alice, Coins: 1000}}
+	for i := 0; i < n; i++ {
+		from, to := i+2, 1
+		fromName := fmt.Sprintf("user%d", from)
+		r.history = append(r.history, models.CoinTransaction{
+			ID:           i + 1,
+			FromUserID:   &from,
+			ToUserID:     &to,
+			Amount:       1,
+			Kind:         models.TxTransfer,
+			CreatedAt:    time.Now(),
+			FromUsername: &fromName,
+			ToUsername:   &alice,
+		})
+	}
+	return r
+}
+
+func TestGetInfo_QueryCountIndependentOfHistory(t *testing.T) {
+	for _, n := range []int{0, 10, 1000} {
+		repo := newHistoryRepo(n)
+		svc := service.NewService(repo, &config.Config{})
+
+		info, err := svc.GetInfo(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(info.CoinHistory.Received) != n {
+			t.Fatalf("history %d: got %d received", n, len(info.CoinHistory.Received))
+		}
+		if repo.queries != 3 {
+			t.Fatalf("history %d: got %d queries, want 3", n, repo.queries)
+		}
+	}
+}
+
+func BenchmarkGetInfo(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("history=%d", n), func(b *testing.B) {
+			repo := newHistoryRepo(n)
+			svc := service.NewService(repo, &config.Config{})
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := svc.GetInfo(1); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(repo.queries)/float64(b.N), "queries/op")
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package service_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"avito-shop/internal/config"
+	"avito-shop/internal/jwtkeys"
+	"avito-shop/internal/models"
+	"avito-shop/internal/service"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Загрузка ключей, ротация и JWKS проверяются в internal/jwtkeys; здесь —
+// только выпуск и разбор access-токенов сервисом.
+
+func loadEd25519Keys(t *testing.T, name string) *jwtkeys.KeySet {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), name+".pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+	keys, err := jwtkeys.Load(path, "", nil)
+	require.NoError(t, err)
+	return keys
+}
+
+func TestKeys_AccessTokenRoundTrip(t *testing.T) {
+	keys := loadEd25519Keys(t, "2024-06")
+	svc := service.NewService(nil, &config.Config{JWTKeys: keys})
+
+	token, err := service.GenerateJWT(keys, models.AccessClaims{UserID: 1, Role: "admin", SessionID: 7, TokenVersion: 2}, time.Minute)
+	require.NoError(t, err)
+
+	claims, err := svc.ParseAccessToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, 1, claims.UserID)
+	assert.Equal(t, "admin", claims.Role)
+	assert.Equal(t, 7, claims.SessionID)
+	assert.Equal(t, 2, claims.TokenVersion)
+
+	// Сервис публикует JWKS своего набора ключей.
+	assert.Equal(t, keys.JWKS(), svc.JWKS())
+}
+
+func TestKeys_ForeignTokenIsInvalid(t *testing.T) {
+	svc := service.NewService(nil, &config.Config{JWTKeys: loadEd25519Keys(t, "main")})
+
+	// Любая ошибка проверки подписи — ErrInvalidToken.
+	for _, keys := range []*jwtkeys.KeySet{loadEd25519Keys(t, "other"), jwtkeys.HMAC("super-secret-key")} {
+		token, err := service.GenerateJWT(keys, models.AccessClaims{UserID: 1, Role: "employee", SessionID: 1, TokenVersion: 0}, time.Minute)
+		require.NoError(t, err)
+		_, err = svc.ParseAccessToken(token)
+		assert.Equal(t, service.ErrInvalidToken, err)
+	}
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"avito-shop/internal/models"
+	"avito-shop/internal/repository"
+)
+
+// startingBalance совпадает со значением, которое CreateUser пишет в
+// users.coins; в журнал оно попадает записью grant от treasury.
+const startingBalance = 1000
+
+// auditLedgerAdjustment — users.coins приведён к журналу командой reconcile.
+const auditLedgerAdjustment = "ledger.adjustment"
+
+// ----------------------------------------
+// LedgerBalance
+// ----------------------------------------
+
+// LedgerBalance пересчитывает баланс пользователя по проводкам журнала,
+// не глядя на users.coins.
+func (s *service) LedgerBalance(userID int) (int, error) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return 0, err
+	}
+	if user == nil {
+		return 0, ErrUserNotFound
+	}
+	return s.repo.GetLedgerBalance(userID)
+}
+
+// ----------------------------------------
+// Reconcile
+// ----------------------------------------
+
+// Reconcile сверяет users.coins с журналом. При repair = true балансы
+// расходящихся пользователей приводятся к значению из журнала — журнал
+// считается источником истины. Проводок ремонт не пишет (журнал и так
+// верен), а каждую правку записывает в audit_log с прежним и новым
+// балансом. Пользователи с отрицательным балансом по журналу не
+// трогаются и попадают в NegativeBalances.
+func (s *service) Reconcile(repair bool) (*models.ReconciliationReport, error) {
+	drifts, err := s.repo.GetBalanceDrifts()
+	if err != nil {
+		return nil, err
+	}
+	unbalanced, err := s.repo.GetUnbalancedTransactions()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.ReconciliationReport{
+		Drifts:                 drifts,
+		UnbalancedTransactions: unbalanced,
+	}
+	if report.Drifts == nil {
+		report.Drifts = []models.BalanceDrift{}
+	}
+	if report.UnbalancedTransactions == nil {
+		report.UnbalancedTransactions = []int{}
+	}
+	report.NegativeBalances = []models.BalanceDrift{}
+	if !repair || len(drifts) == 0 {
+		return report, nil
+	}
+
+	err = s.repo.WithTx(func(repo repository.Repository) error {
+		for _, d := range drifts {
+			// Баланс перечитываем под блокировкой: между отчётом и ремонтом
+			// мог пройти перевод, который поменял и coins, и журнал.
+			user, err := repo.GetUserByIDForUpdate(d.UserID)
+			if err != nil {
+				return err
+			}
+			if user == nil {
+				continue
+			}
+			balance, err := repo.GetLedgerBalance(d.UserID)
+			if err != nil {
+				return err
+			}
+			if user.Coins == balance {
+				continue
+			}
+			if balance < 0 {
+				report.NegativeBalances = append(report.NegativeBalances, models.BalanceDrift{
+					UserID:        user.ID,
+					Username:      user.Username,
+					StoredBalance: user.Coins,
+					LedgerBalance: balance,
+				})
+				continue
+			}
+			if err := repo.UpdateUserCoins(d.UserID, balance); err != nil {
+				return err
+			}
+			// Действие системы, а не пользователя: actor не указывается.
+			if err := writeAudit(repo, 0, auditLedgerAdjustment, user.Username, map[string]int{
+				"storedBalance": user.Coins,
+				"ledgerBalance": balance,
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	report.Repaired = true
+	return report, nil
+}
+
+// counterpartyName — как подписать системную сторону записи в истории.
+func counterpartyName(kind string) string {
+	switch kind {
+	case models.TxGrant, models.TxAdjustment, models.TxExpiry:
+		return models.AccountTreasury
+	default:
+		return models.AccountStore
+	}
+}
+
+// participantName — имя второй стороны записи: пользователь из JOIN или,
+// если его нет, системный счёт.
+func participantName(username *string, kind string) string {
+	if username != nil {
+		return *username
+	}
+	return counterpartyName(kind)
+}
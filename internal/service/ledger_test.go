@@ -0,0 +1,138 @@
+package service_test
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"avito-shop/internal/config"
+	"avito-shop/internal/repository"
+	"avito-shop/internal/service"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var driftColumns = []string{"id", "username", "coins", "balance"}
+
+func TestLedgerBalance(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins, role FROM users WHERE id = $1`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}).
+			AddRow(1, "alice", "somepass", 900, "employee"))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT COALESCE(SUM(amount), 0) FROM ledger_postings WHERE user_id = $1`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(900))
+
+	balance, err := svc.LedgerBalance(1)
+	require.NoError(t, err)
+	assert.Equal(t, 900, balance)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReconcile_ReportOnly(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+
+	mock.ExpectQuery(regexp.QuoteMeta(`WHERE u.coins <> COALESCE(l.balance, 0)`)).
+		WillReturnRows(sqlmock.NewRows(driftColumns).AddRow(2, "bob", 1100, 1000))
+	mock.ExpectQuery(regexp.QuoteMeta(`HAVING COUNT(p.id) = 0 OR SUM(p.amount) <> 0`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	report, err := svc.Reconcile(false)
+	require.NoError(t, err)
+	require.Len(t, report.Drifts, 1)
+	assert.Equal(t, 1100, report.Drifts[0].StoredBalance)
+	assert.Equal(t, 1000, report.Drifts[0].LedgerBalance)
+	assert.Empty(t, report.UnbalancedTransactions)
+	assert.False(t, report.Repaired)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReconcile_Repair(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+
+	mock.ExpectQuery(regexp.QuoteMeta(`WHERE u.coins <> COALESCE(l.balance, 0)`)).
+		WillReturnRows(sqlmock.NewRows(driftColumns).AddRow(2, "bob", 1100, 1000))
+	mock.ExpectQuery(regexp.QuoteMeta(`HAVING COUNT(p.id) = 0 OR SUM(p.amount) <> 0`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	mock.ExpectBegin()
+	expectRepair(mock, 2, "bob", 1100, 1000)
+	mock.ExpectCommit()
+
+	report, err := svc.Reconcile(true)
+	require.NoError(t, err)
+	assert.True(t, report.Repaired)
+	assert.Empty(t, report.NegativeBalances)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReconcile_RepairSkipsNegativeLedger(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+
+	mock.ExpectQuery(regexp.QuoteMeta(`WHERE u.coins <> COALESCE(l.balance, 0)`)).
+		WillReturnRows(sqlmock.NewRows(driftColumns).
+			AddRow(2, "bob", 1100, 1000).
+			AddRow(3, "carol", 50, -20).
+			AddRow(4, "dave", 0, 300))
+	mock.ExpectQuery(regexp.QuoteMeta(`HAVING COUNT(p.id) = 0 OR SUM(p.amount) <> 0`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	// carol с отрицательным балансом по журналу пропускается (CHECK coins >= 0
+	// сорвал бы весь ремонт), остальные чинятся.
+	mock.ExpectBegin()
+	expectRepair(mock, 2, "bob", 1100, 1000)
+	expectLockedBalance(mock, 3, "carol", 50, -20)
+	expectRepair(mock, 4, "dave", 0, 300)
+	mock.ExpectCommit()
+
+	report, err := svc.Reconcile(true)
+	require.NoError(t, err)
+	assert.True(t, report.Repaired)
+	require.Len(t, report.NegativeBalances, 1)
+	assert.Equal(t, "carol", report.NegativeBalances[0].Username)
+	assert.Equal(t, -20, report.NegativeBalances[0].LedgerBalance)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// expectLockedBalance — баланс пользователя, перечитанный под блокировкой.
+func expectLockedBalance(mock sqlmock.Sqlmock, userID int, username string, coins, ledger int) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins, role FROM users WHERE id = $1 FOR UPDATE`)).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}).
+			AddRow(userID, username, "pass", coins, "employee"))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT COALESCE(SUM(amount), 0) FROM ledger_postings WHERE user_id = $1`)).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(ledger))
+}
+
+// expectRepair — users.coins приводится к журналу, правка пишется в audit_log.
+func expectRepair(mock sqlmock.Sqlmock, userID int, username string, coins, ledger int) {
+	expectLockedBalance(mock, userID, username, coins, ledger)
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET coins = $1 WHERE id = $2`)).
+		WithArgs(ledger, userID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO audit_log`)).
+		WithArgs(nil, "ledger.adjustment", username,
+			fmt.Sprintf(`{"ledgerBalance":%d,"storedBalance":%d}`, ledger, coins)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+}
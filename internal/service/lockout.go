@@ -0,0 +1,195 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+var ErrInvalidIP = errors.New("invalid IP address")
+
+// LoginThrottledError — вход временно запрещён из-за неудачных попыток.
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+	// AccountLocked — заблокирован сам аккаунт (порог LoginLockoutThreshold),
+	// а не просто включена задержка между попытками.
+	AccountLocked bool
+}
+
+func (e *LoginThrottledError) Error() string {
+	if e.AccountLocked {
+		return fmt.Sprintf("account is locked, retry after %s", e.RetryAfter.Round(time.Second))
+	}
+	return fmt.Sprintf("too many failed login attempts, retry after %s", e.RetryAfter.Round(time.Second))
+}
+
+const (
+	// Первые попытки бесплатны, дальше каждая неудача удваивает паузу.
+	userFreeAttempts = 3
+	// С одного адреса могут входить несколько сотрудников, поэтому запас
+	// больше, а блокировки аккаунта нет — только задержка.
+	ipFreeAttempts = 20
+
+	loginBackoffBase   = time.Second
+	loginBackoffMax    = 15 * time.Minute
+	loginFailureWindow = 15 * time.Minute
+
+	defaultLockoutThreshold = 10
+	defaultLockoutDuration  = time.Hour
+)
+
+func userAttemptKey(username string) string { return "user:" + username }
+func ipAttemptKey(ip string) string         { return "ip:" + ip }
+
+// loginAttempt — попытка входа, учтённая до проверки пароля.
+type loginAttempt struct {
+	username      string
+	clientIP      string
+	ipLockedUntil *time.Time
+}
+
+// beginLoginAttempt учитывает попытку по имени и адресу до проверки
+// пароля и сразу ставит паузу или блокировку, которая последует за
+// неудачей, — так параллельные попытки не проходят мимо счётчика. Неудача
+// после этого уже учтена; при успехе вызывающий вызывает loginSucceeded.
+// Если по имени или адресу действует блокировка, возвращает
+// *LoginThrottledError.
+func (s *service) beginLoginAttempt(username, clientIP string) (*loginAttempt, error) {
+	now := s.now()
+
+	a, ok, err := s.attempts.Reserve(userAttemptKey(username), now, loginFailureWindow, s.userLockFor)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, &LoginThrottledError{
+			RetryAfter:    a.LockedUntil.Sub(now),
+			AccountLocked: a.Failures >= s.lockoutThreshold(),
+		}
+	}
+
+	attempt := &loginAttempt{username: username, clientIP: clientIP}
+	if clientIP == "" {
+		return attempt, nil
+	}
+	ip, ok, err := s.attempts.Reserve(ipAttemptKey(clientIP), now, loginFailureWindow, ipLockFor)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		// Попытки не было — резерв по имени возвращается.
+		if err := s.attempts.Release(userAttemptKey(username), a.LockedUntil); err != nil {
+			return nil, err
+		}
+		return nil, &LoginThrottledError{RetryAfter: ip.LockedUntil.Sub(now)}
+	}
+	attempt.ipLockedUntil = ip.LockedUntil
+	return attempt, nil
+}
+
+// loginSucceeded снимает учёт удавшейся попытки: счётчик по имени
+// обнуляется, резерв по адресу возвращается.
+func (s *service) loginSucceeded(a *loginAttempt) error {
+	if err := s.attempts.Reset(userAttemptKey(a.username)); err != nil {
+		return err
+	}
+	if a.clientIP == "" {
+		return nil
+	}
+	return s.attempts.Release(ipAttemptKey(a.clientIP), a.ipLockedUntil)
+}
+
+// secondFactorRequired — пароль верный, но вход ждёт второй фактор:
+// резерв по адресу возвращается, а попытка по имени остаётся учтённой.
+// Иначе каждый верный пароль обнулял бы счётчик неверных кодов VerifyMFA.
+func (s *service) secondFactorRequired(a *loginAttempt) error {
+	if a.clientIP == "" {
+		return nil
+	}
+	return s.attempts.Release(ipAttemptKey(a.clientIP), a.ipLockedUntil)
+}
+
+// userLockFor — пауза после failures неудач по имени: блокировка аккаунта
+// с порога LoginLockoutThreshold, до него — растущая задержка.
+func (s *service) userLockFor(failures int) time.Duration {
+	switch {
+	case failures >= s.lockoutThreshold():
+		return s.lockoutDuration()
+	case failures >= userFreeAttempts:
+		return loginBackoff(failures - userFreeAttempts)
+	}
+	return 0
+}
+
+func ipLockFor(failures int) time.Duration {
+	if failures >= ipFreeAttempts {
+		return loginBackoff(failures - ipFreeAttempts)
+	}
+	return 0
+}
+
+// loginBackoff — 1s, 2s, 4s, ... но не больше loginBackoffMax.
+func loginBackoff(n int) time.Duration {
+	d := loginBackoffBase
+	for i := 0; i < n && d < loginBackoffMax; i++ {
+		d *= 2
+	}
+	if d > loginBackoffMax {
+		return loginBackoffMax
+	}
+	return d
+}
+
+func (s *service) lockoutThreshold() int {
+	if s.cfg.LoginLockoutThreshold > 0 {
+		return s.cfg.LoginLockoutThreshold
+	}
+	return defaultLockoutThreshold
+}
+
+func (s *service) lockoutDuration() time.Duration {
+	if s.cfg.LoginLockoutDuration > 0 {
+		return s.cfg.LoginLockoutDuration
+	}
+	return defaultLockoutDuration
+}
+
+// ----------------------------------------
+// Unlock
+// ----------------------------------------
+
+// UnlockUser снимает блокировку и обнуляет счётчик неудач аккаунта.
+func (s *service) UnlockUser(adminID int, username string) error {
+	username = strings.TrimSpace(username)
+	user, err := s.repo.GetUserByUsername(username)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrUserNotFound
+	}
+	if err := s.attempts.Reset(userAttemptKey(username)); err != nil {
+		return err
+	}
+	return writeAudit(s.repo, adminID, auditUserUnlock, username, nil)
+}
+
+// UnlockIP снимает задержку входа с адреса.
+func (s *service) UnlockIP(adminID int, ip string) error {
+	parsed := net.ParseIP(strings.TrimSpace(ip))
+	if parsed == nil {
+		return ErrInvalidIP
+	}
+	if err := s.attempts.Reset(ipAttemptKey(parsed.String())); err != nil {
+		return err
+	}
+	return writeAudit(s.repo, adminID, auditIPUnlock, parsed.String(), nil)
+}
+
+// PurgeLoginAttempts забывает неудачи, по которым давно нет ни попыток,
+// ни действующих блокировок.
+func (s *service) PurgeLoginAttempts() (int64, error) {
+	return s.attempts.Purge(s.now().Add(-24 * time.Hour))
+}
@@ -0,0 +1,275 @@
+package service_test
+
+import (
+	"errors"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"avito-shop/internal/config"
+	"avito-shop/internal/repository"
+	"avito-shop/internal/service"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fakeClock — время, которое двигает сам тест.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) Now() time.Time          { return c.t }
+func (c *fakeClock) Advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{t: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func expectUserByName(mock sqlmock.Sqlmock, username, hash string) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins, role FROM users WHERE username = $1`)).
+		WithArgs(username).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}).
+			AddRow(1, username, hash, 1000, "employee"))
+}
+
+func throttled(t *testing.T, err error) *service.LoginThrottledError {
+	t.Helper()
+	var te *service.LoginThrottledError
+	require.True(t, errors.As(err, &te), "expected LoginThrottledError, got %v", err)
+	return te
+}
+
+func TestAuthUser_BackoffAndLockout(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	clock := newFakeClock()
+	svc := service.NewService(repository.NewRepository(db),
+		&config.Config{JWTSecret: "test-secret", LoginLockoutThreshold: 5, LoginLockoutDuration: time.Hour},
+		service.WithClock(clock.Now))
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("right"), bcrypt.MinCost)
+
+	// Две бесплатные неудачи, третья включает паузу в 1s.
+	for i := 0; i < 3; i++ {
+		expectUserByName(mock, "alice", string(hash))
+		_, err := svc.AuthUser("alice", "wrong", "10.0.0.1")
+		assert.Equal(t, service.ErrInvalidPassword, err)
+	}
+	_, err = svc.AuthUser("alice", "right", "10.0.0.1")
+	te := throttled(t, err)
+	assert.False(t, te.AccountLocked)
+	assert.Equal(t, time.Second, te.RetryAfter)
+
+	// Пауза удваивается.
+	clock.Advance(time.Second)
+	expectUserByName(mock, "alice", string(hash))
+	_, err = svc.AuthUser("alice", "wrong", "10.0.0.1")
+	assert.Equal(t, service.ErrInvalidPassword, err)
+	_, err = svc.AuthUser("alice", "wrong", "10.0.0.1")
+	assert.Equal(t, 2*time.Second, throttled(t, err).RetryAfter)
+
+	// Пятая неудача блокирует аккаунт на LoginLockoutDuration.
+	clock.Advance(2 * time.Second)
+	expectUserByName(mock, "alice", string(hash))
+	_, err = svc.AuthUser("alice", "wrong", "10.0.0.1")
+	assert.Equal(t, service.ErrInvalidPassword, err)
+
+	clock.Advance(10 * time.Minute)
+	_, err = svc.AuthUser("alice", "right", "10.0.0.2")
+	te = throttled(t, err)
+	assert.True(t, te.AccountLocked)
+	assert.Equal(t, 50*time.Minute, te.RetryAfter)
+
+	// Админ снимает блокировку, и верный пароль снова проходит.
+	expectUserByName(mock, "alice", string(hash))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO audit_log`)).
+		WithArgs(99, "user.unlock", "alice", "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	require.NoError(t, svc.UnlockUser(99, "alice"))
+
+	expectUserByName(mock, "alice", string(hash))
+	expectNoTOTP(mock, 1)
+	expectSession(mock, 1, 1)
+	_, err = svc.AuthUser("alice", "right", "10.0.0.1")
+	require.NoError(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAuthUser_SuccessResetsCounter(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	clock := newFakeClock()
+	svc := service.NewService(repository.NewRepository(db), &config.Config{JWTSecret: "test-secret"},
+		service.WithClock(clock.Now))
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("right"), bcrypt.MinCost)
+
+	for i := 0; i < 2; i++ {
+		expectUserByName(mock, "alice", string(hash))
+		_, err := svc.AuthUser("alice", "wrong", "")
+		assert.Equal(t, service.ErrInvalidPassword, err)
+	}
+	expectUserByName(mock, "alice", string(hash))
+	expectNoTOTP(mock, 1)
+	expectSession(mock, 1, 1)
+	_, err = svc.AuthUser("alice", "right", "")
+	require.NoError(t, err)
+
+	// После успешного входа снова две бесплатные попытки.
+	for i := 0; i < 2; i++ {
+		expectUserByName(mock, "alice", string(hash))
+		_, err := svc.AuthUser("alice", "wrong", "")
+		assert.Equal(t, service.ErrInvalidPassword, err)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAuthUser_IPThrottling(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	clock := newFakeClock()
+	svc := service.NewService(repository.NewRepository(db), &config.Config{
+		JWTSecret:        "test-secret",
+		RegistrationMode: config.RegistrationExplicit,
+	}, service.WithClock(clock.Now))
+
+	// Перебор разных имён с одного адреса.
+	for i := 0; i < 20; i++ {
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins, role FROM users WHERE username = $1`)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}))
+		_, err := svc.AuthUser("user"+string(rune('a'+i)), "guess", "10.0.0.1")
+		assert.Equal(t, service.ErrUserNotFound, err)
+	}
+	_, err = svc.AuthUser("bob", "guess", "10.0.0.1")
+	te := throttled(t, err)
+	assert.False(t, te.AccountLocked)
+
+	// Другой адрес не затронут.
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins, role FROM users WHERE username = $1`)).
+		WithArgs("bob").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}))
+	_, err = svc.AuthUser("bob", "guess", "10.0.0.2")
+	assert.Equal(t, service.ErrUserNotFound, err)
+
+	// Снятие задержки с адреса.
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO audit_log`)).
+		WithArgs(99, "ip.unlock", "10.0.0.1", "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	require.NoError(t, svc.UnlockIP(99, "10.0.0.1"))
+	assert.Equal(t, service.ErrInvalidIP, svc.UnlockIP(99, "not-an-ip"))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAuthUser_ConcurrentGuessesAreThrottled(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	mock.MatchExpectationsInOrder(false)
+
+	clock := newFakeClock()
+	svc := service.NewService(repository.NewRepository(db), &config.Config{JWTSecret: "test-secret"},
+		service.WithClock(clock.Now))
+
+	// До пароля доходят только три бесплатные попытки: каждая учитывается
+	// до bcrypt, и третья сразу ставит паузу для остальных.
+	hash, _ := bcrypt.GenerateFromPassword([]byte("right"), bcrypt.MinCost)
+	for i := 0; i < 3; i++ {
+		expectUserByName(mock, "alice", string(hash))
+	}
+
+	const guesses = 50
+	errs := make(chan error, guesses)
+	var wg sync.WaitGroup
+	for i := 0; i < guesses; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := svc.AuthUser("alice", "wrong", "10.0.0.1")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	var invalid, limited int
+	for err := range errs {
+		var te *service.LoginThrottledError
+		switch {
+		case err == service.ErrInvalidPassword:
+			invalid++
+		case errors.As(err, &te):
+			limited++
+		default:
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	assert.Equal(t, 3, invalid)
+	assert.Equal(t, guesses-3, limited)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresLoginAttemptStore(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	lockFor := func(failures int) time.Duration {
+		if failures >= 4 {
+			return time.Minute
+		}
+		return 0
+	}
+	store := repository.NewPostgresLoginAttemptStore(db)
+	columns := []string{"key", "failures", "last_failure_at", "locked_until"}
+
+	// Четвёртая попытка в окне: счётчик растёт и сразу ставится блокировка.
+	until := now.Add(time.Minute)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO login_attempts (key, last_failure_at) VALUES ($1, $2) ON CONFLICT (key) DO NOTHING`)).
+		WithArgs("user:alice", now).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM login_attempts WHERE key = $1 FOR UPDATE`)).
+		WithArgs("user:alice").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("user:alice", 3, now.Add(-time.Minute), nil))
+	mock.ExpectQuery(regexp.QuoteMeta(`UPDATE login_attempts SET failures = $2, last_failure_at = $3, locked_until = $4`)).
+		WithArgs("user:alice", 4, now, until).
+		WillReturnRows(sqlmock.NewRows([]string{"locked_until"}).AddRow(until))
+	mock.ExpectCommit()
+
+	a, ok, err := store.Reserve("user:alice", now, 15*time.Minute, lockFor)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 4, a.Failures)
+
+	// Пока блокировка действует, попытка не учитывается.
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO login_attempts`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`FOR UPDATE`)).
+		WithArgs("user:alice").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("user:alice", 4, now, until))
+	mock.ExpectRollback()
+
+	a, ok, err = store.Reserve("user:alice", now.Add(time.Second), 15*time.Minute, lockFor)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, until, *a.LockedUntil)
+
+	mock.ExpectExec(regexp.QuoteMeta(`SET failures = GREATEST(failures - 1, 0)`)).
+		WithArgs("ip:10.0.0.1", until).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, store.Release("ip:10.0.0.1", &until))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,312 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"avito-shop/internal/models"
+	"avito-shop/internal/repository"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnrolled    = errors.New("two-factor authentication enrolment has not been started")
+	ErrMFANotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrInvalidMFACode    = errors.New("invalid two-factor code")
+	ErrInvalidMFAToken   = errors.New("invalid or expired mfa token")
+)
+
+const (
+	totpIssuer     = "Avito Shop"
+	totpPeriod     = 30 // секунд
+	totpDigits     = 6
+	totpSkew       = 1 // сколько соседних шагов принимаем из-за расхождения часов
+	totpSecretSize = 20
+
+	// mfaTokenTTL — сколько живёт токен «пароль принят, ждём код».
+	mfaTokenTTL       = 5 * time.Minute
+	mfaTokenPurpose   = "mfa"
+	recoveryCodeCount = 10
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// ----------------------------------------
+// Enrolment
+// ----------------------------------------
+
+// EnrollTOTP выдаёт новый секрет. 2FA включится только после ConfirmTOTP
+// с кодом из приложения; повторный вызов до этого заменяет секрет.
+func (s *service) EnrollTOTP(userID int) (*models.TOTPEnrollResponse, error) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	current, err := s.repo.GetUserTOTP(userID)
+	if err != nil {
+		return nil, err
+	}
+	if current != nil && current.Enabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	raw := make([]byte, totpSecretSize)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	secret := totpEncoding.EncodeToString(raw)
+	if err := s.repo.SaveTOTPSecret(userID, secret); err != nil {
+		return nil, err
+	}
+	return &models.TOTPEnrollResponse{
+		Secret:          secret,
+		ProvisioningURI: provisioningURI(user.Username, secret),
+	}, nil
+}
+
+// ConfirmTOTP включает 2FA, если code подходит к выданному секрету, и
+// возвращает коды восстановления. В открытом виде они показываются только
+// здесь.
+func (s *service) ConfirmTOTP(userID int, code string) (*models.RecoveryCodesResponse, error) {
+	var codes []string
+	err := s.repo.WithTx(func(repo repository.Repository) error {
+		t, err := repo.GetUserTOTP(userID)
+		if err != nil {
+			return err
+		}
+		if t == nil {
+			return ErrMFANotEnrolled
+		}
+		if t.Enabled {
+			return ErrMFAAlreadyEnabled
+		}
+		step, ok := matchTOTP(t.Secret, code, s.now(), t.LastUsedStep)
+		if !ok {
+			return ErrInvalidMFACode
+		}
+		if _, err := repo.UseTOTPStep(userID, step); err != nil {
+			return err
+		}
+		if err := repo.EnableTOTP(userID); err != nil {
+			return err
+		}
+
+		codes, err = newRecoveryCodes()
+		if err != nil {
+			return err
+		}
+		hashes := make([]string, len(codes))
+		for i, c := range codes {
+			hashes[i] = hashToken(normalizeRecoveryCode(c))
+		}
+		return repo.ReplaceRecoveryCodes(userID, hashes)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &models.RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// DisableTOTP выключает 2FA; нужен действующий код или код восстановления.
+func (s *service) DisableTOTP(userID int, code string) error {
+	return s.repo.WithTx(func(repo repository.Repository) error {
+		t, err := repo.GetUserTOTP(userID)
+		if err != nil {
+			return err
+		}
+		if t == nil || !t.Enabled {
+			return ErrMFANotEnabled
+		}
+		ok, err := s.checkSecondFactor(repo, t, code)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrInvalidMFACode
+		}
+		return repo.DeleteTOTP(userID)
+	})
+}
+
+// ----------------------------------------
+// Login
+// ----------------------------------------
+
+// mfaChallenge возвращает ответ «нужен второй фактор», если у
+// пользователя включена 2FA, иначе nil.
+func (s *service) mfaChallenge(user *models.User) (*models.AuthResponse, error) {
+	t, err := s.repo.GetUserTOTP(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil || !t.Enabled {
+		return nil, nil
+	}
+	token, err := s.keys.Sign(jwt.MapClaims{
+		"user_id":  user.ID,
+		"username": user.Username,
+		"purpose":  mfaTokenPurpose,
+		// Срок проверяет jwt по реальным часам, как и у access-токенов.
+		"exp": time.Now().Add(mfaTokenTTL).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &models.AuthResponse{MFARequired: true, MFAToken: token}, nil
+}
+
+// VerifyMFA завершает вход с 2FA: mfaToken из AuthUser плюс TOTP-код или
+// код восстановления. Неверные коды считаются в те же счётчики, что и
+// неверные пароли.
+func (s *service) VerifyMFA(mfaToken, code, clientIP string) (*models.AuthResponse, error) {
+	claims := jwt.MapClaims{}
+	token, err := s.keys.Parse(mfaToken, claims)
+	if err != nil || !token.Valid || claims["purpose"] != mfaTokenPurpose {
+		return nil, ErrInvalidMFAToken
+	}
+	userIDf, _ := claims["user_id"].(float64)
+	username, _ := claims["username"].(string)
+	userID := int(userIDf)
+
+	attempt, err := s.beginLoginAttempt(username, clientIP)
+	if err != nil {
+		return nil, err
+	}
+
+	var user *models.User
+	err = s.repo.WithTx(func(repo repository.Repository) error {
+		var err error
+		if user, err = repo.GetUserByID(userID); err != nil {
+			return err
+		}
+		t, err := repo.GetUserTOTP(userID)
+		if err != nil {
+			return err
+		}
+		if user == nil || t == nil || !t.Enabled {
+			return ErrInvalidMFAToken
+		}
+		ok, err := s.checkSecondFactor(repo, t, code)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrInvalidMFACode
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.loginSucceeded(attempt); err != nil {
+		return nil, err
+	}
+	return s.issueTokens(user.ID, user.Username, user.Role)
+}
+
+// checkSecondFactor принимает TOTP-код (один раз на шаг) или ещё не
+// использованный код восстановления.
+func (s *service) checkSecondFactor(repo repository.Repository, t *models.UserTOTP, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if len(code) == totpDigits {
+		step, ok := matchTOTP(t.Secret, code, s.now(), t.LastUsedStep)
+		if !ok {
+			return false, nil
+		}
+		return repo.UseTOTPStep(t.UserID, step)
+	}
+	return repo.UseRecoveryCode(t.UserID, hashToken(normalizeRecoveryCode(code)))
+}
+
+// ----------------------------------------
+// TOTP (RFC 6238)
+// ----------------------------------------
+
+// GenerateTOTPCode — код для секрета в base32 на момент t.
+func GenerateTOTPCode(secret string, t time.Time) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	return totpCode(key, t.Unix()/totpPeriod), nil
+}
+
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
+
+// matchTOTP ищет шаг около now, которому соответствует code. Шаги не
+// новее lastStep не принимаются, чтобы перехваченный код нельзя было
+// повторить.
+func matchTOTP(secret, code string, now time.Time, lastStep int64) (int64, bool) {
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for d := int64(-totpSkew); d <= totpSkew; d++ {
+		step := current + d
+		if step <= lastStep {
+			continue
+		}
+		if hmac.Equal([]byte(totpCode(key, step)), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func provisioningURI(username, secret string) string {
+	label := url.PathEscape(totpIssuer + ":" + username)
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", totpIssuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(totpDigits))
+	q.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+// newRecoveryCodes — коды вида "abcde-fghij".
+func newRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		raw := make([]byte, 7)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		c := strings.ToLower(totpEncoding.EncodeToString(raw))[:10]
+		codes[i] = c[:5] + "-" + c[5:]
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
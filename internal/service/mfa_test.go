@@ -0,0 +1,307 @@
+package service_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"avito-shop/internal/config"
+	"avito-shop/internal/jwtkeys"
+	"avito-shop/internal/models"
+	"avito-shop/internal/repository"
+	"avito-shop/internal/service"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Секрет из RFC 6238 ("12345678901234567890") в base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func expectTOTP(mock sqlmock.Sqlmock, userID int, secret string, enabled bool, lastStep int64) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT user_id, secret, enabled, last_used_step FROM user_totp WHERE user_id = $1`)).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "secret", "enabled", "last_used_step"}).
+			AddRow(userID, secret, enabled, lastStep))
+}
+
+// expectNoTOTP — у пользователя 2FA не настроена.
+func expectNoTOTP(mock sqlmock.Sqlmock, userID int) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT user_id, secret, enabled, last_used_step FROM user_totp WHERE user_id = $1`)).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "secret", "enabled", "last_used_step"}))
+}
+
+func expectUserByID(mock sqlmock.Sqlmock, userID int, username string) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins, role FROM users WHERE id = $1`)).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}).
+			AddRow(userID, username, "", 1000, "employee"))
+}
+
+func TestGenerateTOTPCode_RFC6238(t *testing.T) {
+	cases := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for ts, want := range cases {
+		code, err := service.GenerateTOTPCode(rfcSecret, time.Unix(ts, 0))
+		require.NoError(t, err)
+		assert.Equal(t, want, code, "t=%d", ts)
+	}
+}
+
+func TestEnrollAndConfirmTOTP(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	clock := newFakeClock()
+	svc := service.NewService(repository.NewRepository(db), &config.Config{JWTSecret: "test-secret"},
+		service.WithClock(clock.Now))
+
+	expectUserByID(mock, 1, "alice")
+	expectNoTOTP(mock, 1)
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO user_totp (user_id, secret) VALUES ($1, $2)`)).
+		WithArgs(1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	enroll, err := svc.EnrollTOTP(1)
+	require.NoError(t, err)
+	assert.Len(t, enroll.Secret, 32)
+	assert.True(t, strings.HasPrefix(enroll.ProvisioningURI, "otpauth://totp/Avito%20Shop:alice?"))
+	assert.Contains(t, enroll.ProvisioningURI, "secret="+enroll.Secret)
+
+	// Неверный код не включает 2FA.
+	mock.ExpectBegin()
+	expectTOTP(mock, 1, enroll.Secret, false, 0)
+	mock.ExpectRollback()
+	_, err = svc.ConfirmTOTP(1, "000000")
+	assert.Equal(t, service.ErrInvalidMFACode, err)
+
+	code, err := service.GenerateTOTPCode(enroll.Secret, clock.Now())
+	require.NoError(t, err)
+	step := clock.Now().Unix() / 30
+
+	mock.ExpectBegin()
+	expectTOTP(mock, 1, enroll.Secret, false, 0)
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE user_totp SET last_used_step = $1 WHERE user_id = $2 AND last_used_step < $1`)).
+		WithArgs(step, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE user_totp SET enabled = TRUE WHERE user_id = $1`)).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM recovery_codes WHERE user_id = $1`)).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO recovery_codes (user_id, code_hash) SELECT $1, unnest($2::text[])`)).
+		WithArgs(1, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 10))
+	mock.ExpectCommit()
+
+	resp, err := svc.ConfirmTOTP(1, code)
+	require.NoError(t, err)
+	require.Len(t, resp.RecoveryCodes, 10)
+	assert.Regexp(t, `^[a-z2-7]{5}-[a-z2-7]{5}$`, resp.RecoveryCodes[0])
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEnrollTOTP_AlreadyEnabled(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{JWTSecret: "test-secret"})
+
+	expectUserByID(mock, 1, "alice")
+	expectTOTP(mock, 1, rfcSecret, true, 0)
+
+	_, err = svc.EnrollTOTP(1)
+	assert.Equal(t, service.ErrMFAAlreadyEnabled, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAuthUser_MFAFlow(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	clock := newFakeClock()
+	svc := service.NewService(repository.NewRepository(db), &config.Config{JWTSecret: "test-secret"},
+		service.WithClock(clock.Now))
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("right"), bcrypt.MinCost)
+
+	// Пароль верный, но токенов ещё нет — только mfaToken.
+	expectUserByName(mock, "alice", string(hash))
+	expectTOTP(mock, 1, rfcSecret, true, 0)
+	challenge, err := svc.AuthUser("alice", "right", "")
+	require.NoError(t, err)
+	assert.True(t, challenge.MFARequired)
+	assert.Empty(t, challenge.Token)
+	assert.Empty(t, challenge.RefreshToken)
+	require.NotEmpty(t, challenge.MFAToken)
+
+	// mfaToken не даёт доступа к API.
+	_, err = svc.ParseAccessToken(challenge.MFAToken)
+	assert.Equal(t, service.ErrInvalidToken, err)
+
+	code, err := service.GenerateTOTPCode(rfcSecret, clock.Now())
+	require.NoError(t, err)
+	step := clock.Now().Unix() / 30
+
+	mock.ExpectBegin()
+	expectUserByID(mock, 1, "alice")
+	expectTOTP(mock, 1, rfcSecret, true, 0)
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE user_totp SET last_used_step = $1`)).
+		WithArgs(step, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	expectSession(mock, 1, 5)
+
+	resp, err := svc.VerifyMFA(challenge.MFAToken, code, "")
+	require.NoError(t, err)
+	assert.NotEmpty(t, resp.Token)
+	assert.NotEmpty(t, resp.RefreshToken)
+
+	// Тот же код второй раз не принимается.
+	mock.ExpectBegin()
+	expectUserByID(mock, 1, "alice")
+	expectTOTP(mock, 1, rfcSecret, true, step)
+	mock.ExpectRollback()
+
+	_, err = svc.VerifyMFA(challenge.MFAToken, code, "")
+	assert.Equal(t, service.ErrInvalidMFACode, err)
+
+	// Код восстановления: регистр и дефис не важны.
+	mock.ExpectBegin()
+	expectUserByID(mock, 1, "alice")
+	expectTOTP(mock, 1, rfcSecret, true, step)
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE recovery_codes SET used_at = NOW()`)).
+		WithArgs(1, sha("abcdefghij")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	expectSession(mock, 1, 6)
+
+	_, err = svc.VerifyMFA(challenge.MFAToken, "ABCDE-FGHIJ", "")
+	require.NoError(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// Верный пароль не обнуляет неверные коды: чередуя /api/auth и
+// /api/auth/mfa, коды не перебрать.
+func TestVerifyMFA_FailuresSurvivePasswordLogin(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	clock := newFakeClock()
+	svc := service.NewService(repository.NewRepository(db),
+		&config.Config{JWTSecret: "test-secret", LoginLockoutThreshold: 5, LoginLockoutDuration: time.Hour},
+		service.WithClock(clock.Now))
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("right"), bcrypt.MinCost)
+
+	// Попытки по имени: пароль 1, код 2, пароль 3, код 4, пароль 5 — блокировка.
+	for i := 0; i < 3; i++ {
+		expectUserByName(mock, "alice", string(hash))
+		expectTOTP(mock, 1, rfcSecret, true, 0)
+		challenge, err := svc.AuthUser("alice", "right", "10.0.0.1")
+		require.NoError(t, err)
+		require.True(t, challenge.MFARequired)
+		clock.Advance(time.Minute)
+
+		if i == 2 {
+			_, err = svc.VerifyMFA(challenge.MFAToken, "wrong-code", "10.0.0.1")
+			te := throttled(t, err)
+			assert.True(t, te.AccountLocked)
+			assert.Equal(t, 59*time.Minute, te.RetryAfter)
+			break
+		}
+
+		mock.ExpectBegin()
+		expectUserByID(mock, 1, "alice")
+		expectTOTP(mock, 1, rfcSecret, true, 0)
+		mock.ExpectExec(regexp.QuoteMeta(`UPDATE recovery_codes SET used_at = NOW()`)).
+			WithArgs(1, sha("wrongcode")).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+		_, err = svc.VerifyMFA(challenge.MFAToken, "wrong-code", "10.0.0.1")
+		assert.Equal(t, service.ErrInvalidMFACode, err)
+		clock.Advance(time.Minute)
+	}
+
+	// Пароль тоже больше не принимается.
+	_, err = svc.AuthUser("alice", "right", "10.0.0.1")
+	assert.True(t, throttled(t, err).AccountLocked)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVerifyMFA_InvalidToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{JWTSecret: "test-secret"})
+
+	// Обычный access-токен вместо mfaToken не подходит.
+	access, err := service.GenerateJWT(jwtkeys.HMAC("test-secret"), models.AccessClaims{UserID: 1, Role: "employee", SessionID: 1, TokenVersion: 0}, time.Minute)
+	require.NoError(t, err)
+
+	_, err = svc.VerifyMFA(access, "123456", "")
+	assert.Equal(t, service.ErrInvalidMFAToken, err)
+	_, err = svc.VerifyMFA("garbage", "123456", "")
+	assert.Equal(t, service.ErrInvalidMFAToken, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDisableTOTP(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	clock := newFakeClock()
+	svc := service.NewService(repository.NewRepository(db), &config.Config{JWTSecret: "test-secret"},
+		service.WithClock(clock.Now))
+
+	mock.ExpectBegin()
+	expectNoTOTP(mock, 1)
+	mock.ExpectRollback()
+	assert.Equal(t, service.ErrMFANotEnabled, svc.DisableTOTP(1, "123456"))
+
+	mock.ExpectBegin()
+	expectTOTP(mock, 1, rfcSecret, true, 0)
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE recovery_codes SET used_at = NOW()`)).
+		WithArgs(1, sha("wrongcode")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	assert.Equal(t, service.ErrInvalidMFACode, svc.DisableTOTP(1, "wrong-code"))
+
+	code, err := service.GenerateTOTPCode(rfcSecret, clock.Now())
+	require.NoError(t, err)
+
+	mock.ExpectBegin()
+	expectTOTP(mock, 1, rfcSecret, true, 0)
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE user_totp SET last_used_step = $1`)).
+		WithArgs(clock.Now().Unix()/30, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM recovery_codes WHERE user_id = $1`)).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 10))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM user_totp WHERE user_id = $1`)).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	require.NoError(t, svc.DisableTOTP(1, code))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
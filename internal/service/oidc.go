@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"avito-shop/internal/models"
+	"avito-shop/internal/oidc"
+	"avito-shop/internal/repository"
+
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrOIDCDisabled            = errors.New("oidc login is not configured")
+	ErrOIDCProviderUnavailable = errors.New("oidc provider is unavailable")
+	ErrInvalidOIDCState        = errors.New("invalid or expired oidc login state")
+	ErrOIDCLoginFailed         = errors.New("oidc login failed")
+	ErrOIDCAccountExists       = errors.New("username is already taken by an account not linked to this identity")
+	ErrOIDCIdentityLinked      = errors.New("this identity is already linked to another account")
+)
+
+const (
+	oidcStateTTL     = 10 * time.Minute
+	oidcStatePurpose = "oidc"
+
+	auditOIDCLink = "user.oidc_link"
+)
+
+// ----------------------------------------
+// OIDC login
+// ----------------------------------------
+
+// StartOIDCLogin готовит authorization code flow: state, nonce и PKCE
+// verifier подписываются ключами сервиса в StateToken, который клиент
+// возвращает в FinishOIDCLogin (обычно через cookie).
+func (s *service) StartOIDCLogin() (*models.OIDCLoginStart, error) {
+	return s.startOIDC(0)
+}
+
+// StartOIDCLink — то же, что StartOIDCLogin, но для уже вошедшего
+// пользователя: callback привяжет учётную запись провайдера к userID, а не
+// станет искать или заводить пользователя по имени.
+func (s *service) StartOIDCLink(userID int) (*models.OIDCLoginStart, error) {
+	return s.startOIDC(userID)
+}
+
+// startOIDC подписывает состояние входа; linkUserID > 0 — режим привязки.
+func (s *service) startOIDC(linkUserID int) (*models.OIDCLoginStart, error) {
+	if s.oidc == nil {
+		return nil, ErrOIDCDisabled
+	}
+	state, err := oidc.RandomString()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		return nil, err
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		return nil, err
+	}
+
+	authURL, err := s.oidc.AuthCodeURL(context.Background(), state, nonce, challenge)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCProviderUnavailable, err)
+	}
+	stateClaims := jwt.MapClaims{
+		"purpose":  oidcStatePurpose,
+		"state":    state,
+		"nonce":    nonce,
+		"verifier": verifier,
+		"exp":      time.Now().Add(oidcStateTTL).Unix(),
+	}
+	if linkUserID > 0 {
+		stateClaims["link_user_id"] = linkUserID
+	}
+	stateToken, err := s.keys.Sign(stateClaims)
+	if err != nil {
+		return nil, err
+	}
+	return &models.OIDCLoginStart{AuthURL: authURL, StateToken: stateToken}, nil
+}
+
+// FinishOIDCLogin обменивает code на ID token, проверяет его и открывает
+// сессию магазина для привязанного пользователя. Для нового (iss, sub)
+// заводится пользователь с именем из OIDCUsernameClaim (или sub) и
+// стартовым балансом. Если вход начат StartOIDCLink, учётная запись
+// провайдера сначала привязывается к пользователю из состояния.
+func (s *service) FinishOIDCLogin(stateToken, state, code string) (*models.AuthResponse, error) {
+	if s.oidc == nil {
+		return nil, ErrOIDCDisabled
+	}
+	claims := jwt.MapClaims{}
+	token, err := s.keys.Parse(stateToken, claims)
+	if err != nil || !token.Valid || claims["purpose"] != oidcStatePurpose {
+		return nil, ErrInvalidOIDCState
+	}
+	expected, _ := claims["state"].(string)
+	if expected == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(state)) != 1 {
+		return nil, ErrInvalidOIDCState
+	}
+	if code == "" {
+		return nil, fmt.Errorf("%w: missing code", ErrOIDCLoginFailed)
+	}
+	nonce, _ := claims["nonce"].(string)
+	verifier, _ := claims["verifier"].(string)
+	linkUserID, _ := claims["link_user_id"].(float64)
+
+	ctx := context.Background()
+	rawIDToken, err := s.oidc.Exchange(ctx, code, verifier)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCLoginFailed, err)
+	}
+	idToken, err := s.oidc.VerifyIDToken(ctx, rawIDToken, nonce)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCLoginFailed, err)
+	}
+
+	var user *models.User
+	if linkUserID > 0 {
+		user, err = s.linkOIDCIdentity(int(linkUserID), idToken)
+	} else {
+		user, err = s.oidcUser(idToken)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Провайдер заменяет только пароль: с включённой 2FA вход, как и в
+	// AuthUser, завершается через VerifyMFA.
+	challenge, err := s.mfaChallenge(user)
+	if err != nil {
+		return nil, err
+	}
+	if challenge != nil {
+		return challenge, nil
+	}
+	return s.issueTokens(user.ID, user.Username, user.Role)
+}
+
+// oidcUser находит пользователя по (iss, sub). При первом входе заводит
+// нового пользователя с именем из OIDC_USERNAME_CLAIM и сразу привязывает
+// к нему учётную запись провайдера. К существующим аккаунтам вход по имени
+// не привязывается: имя у провайдера не уникально и часто редактируется
+// самим пользователем, так что совпадение имён ничего не доказывает.
+// Существующий аккаунт привязывает сам владелец — см. linkOIDCIdentity.
+func (s *service) oidcUser(id *oidc.IDToken) (*models.User, error) {
+	user, err := s.repo.GetUserByIdentity(id.Issuer, id.Subject)
+	if err != nil || user != nil {
+		return user, err
+	}
+
+	username, _ := id.Claims[s.oidcUsernameClaim()].(string)
+	username = strings.TrimSpace(username)
+	if username == "" {
+		username = id.Subject
+	}
+	if !usernameRe.MatchString(username) {
+		return nil, fmt.Errorf("%w: username %q is not allowed", ErrOIDCLoginFailed, username)
+	}
+
+	// Пароль случайный: такой аккаунт входит только через провайдера,
+	// пока пароль не сбросят.
+	password, err := oidc.RandomString()
+	if err != nil {
+		return nil, err
+	}
+	hashedPass, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	var userID int
+	err = s.repo.WithTx(func(repo repository.Repository) error {
+		if userID, err = insertAccount(repo, username, string(hashedPass)); err != nil {
+			return err
+		}
+		return repo.InsertUserIdentity(userID, id.Issuer, id.Subject)
+	})
+	if err == ErrUsernameTaken || err == repository.ErrAlreadyExists {
+		// Либо параллельный первый вход той же учётной записи уже создал
+		// пользователя, либо имя занято чужим аккаунтом.
+		if user, err = s.repo.GetUserByIdentity(id.Issuer, id.Subject); err != nil || user != nil {
+			return user, err
+		}
+		return nil, ErrOIDCAccountExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &models.User{ID: userID, Username: username, Coins: startingBalance, Role: models.RoleEmployee}, nil
+}
+
+// linkOIDCIdentity привязывает (iss, sub) к пользователю, который начал
+// привязку из своей сессии. Учётная запись провайдера, уже привязанная к
+// другому пользователю, не перепривязывается.
+func (s *service) linkOIDCIdentity(userID int, id *oidc.IDToken) (*models.User, error) {
+	var user *models.User
+	err := s.repo.WithTx(func(repo repository.Repository) error {
+		linked, err := repo.GetUserByIdentity(id.Issuer, id.Subject)
+		if err != nil {
+			return err
+		}
+		if linked != nil {
+			if linked.ID != userID {
+				return ErrOIDCIdentityLinked
+			}
+			user = linked
+			return nil
+		}
+		if user, err = repo.GetUserByID(userID); err != nil {
+			return err
+		}
+		if user == nil {
+			return ErrUserNotFound
+		}
+		if err := repo.InsertUserIdentity(userID, id.Issuer, id.Subject); err != nil {
+			if err == repository.ErrAlreadyExists {
+				return ErrOIDCIdentityLinked
+			}
+			return err
+		}
+		return writeAudit(repo, userID, auditOIDCLink, user.Username, map[string]string{
+			"issuer":  id.Issuer,
+			"subject": id.Subject,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *service) oidcUsernameClaim() string {
+	if s.cfg.OIDCUsernameClaim != "" {
+		return s.cfg.OIDCUsernameClaim
+	}
+	return "preferred_username"
+}
@@ -0,0 +1,375 @@
+package service_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"avito-shop/internal/config"
+	"avito-shop/internal/repository"
+	"avito-shop/internal/service"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubIdP — минимальный OIDC-провайдер: discovery, JWKS, authorize (как
+// функция теста, без браузера) и token endpoint с проверкой PKCE.
+type stubIdP struct {
+	t   *testing.T
+	srv *httptest.Server
+	key ed25519.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]stubGrant
+	// extra переопределяет claims выдаваемого ID token.
+	extra jwt.MapClaims
+}
+
+type stubGrant struct {
+	challenge, nonce, subject, username string
+}
+
+const (
+	stubClientID     = "avito-shop"
+	stubClientSecret = "shop-secret"
+	stubRedirectURL  = "http://shop.local/api/auth/oidc/callback"
+)
+
+func newStubIdP(t *testing.T) *stubIdP {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	idp := &stubIdP{t: t, key: priv, codes: map[string]stubGrant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.srv.URL,
+			"authorization_endpoint": idp.srv.URL + "/authorize",
+			"token_endpoint":         idp.srv.URL + "/token",
+			"jwks_uri":               idp.srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "OKP", "crv": "Ed25519", "kid": "idp-1", "use": "sig", "alg": "EdDSA",
+				"x": base64.RawURLEncoding.EncodeToString(priv.Public().(ed25519.PublicKey)),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", idp.token)
+	idp.srv = httptest.NewServer(mux)
+	t.Cleanup(idp.srv.Close)
+	return idp
+}
+
+// authorize имитирует вход пользователя у провайдера и возвращает code.
+func (idp *stubIdP) authorize(authURL, subject, username string) string {
+	u, err := url.Parse(authURL)
+	require.NoError(idp.t, err)
+	q := u.Query()
+	assert.Equal(idp.t, idp.srv.URL+"/authorize", u.Scheme+"://"+u.Host+u.Path)
+	assert.Equal(idp.t, "code", q.Get("response_type"))
+	assert.Equal(idp.t, stubClientID, q.Get("client_id"))
+	assert.Equal(idp.t, stubRedirectURL, q.Get("redirect_uri"))
+	assert.Equal(idp.t, "S256", q.Get("code_challenge_method"))
+	assert.Contains(idp.t, q.Get("scope"), "openid")
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	code := "code-" + subject
+	idp.codes[code] = stubGrant{challenge: q.Get("code_challenge"), nonce: q.Get("nonce"), subject: subject, username: username}
+	return code
+}
+
+func (idp *stubIdP) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, _ := r.BasicAuth()
+	if id != stubClientID || secret != stubClientSecret {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+		return
+	}
+	idp.mu.Lock()
+	grant, ok := idp.codes[r.FormValue("code")]
+	delete(idp.codes, r.FormValue("code"))
+	idp.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+	if !ok || r.FormValue("grant_type") != "authorization_code" ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":                idp.srv.URL,
+		"aud":                stubClientID,
+		"sub":                grant.subject,
+		"preferred_username": grant.username,
+		"nonce":              grant.nonce,
+		"iat":                time.Now().Unix(),
+		"exp":                time.Now().Add(time.Minute).Unix(),
+	}
+	for k, v := range idp.extra {
+		claims[k] = v
+	}
+	tok := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	tok.Header["kid"] = "idp-1"
+	signed, err := tok.SignedString(idp.key)
+	require.NoError(idp.t, err)
+	_ = json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "token_type": "Bearer", "id_token": signed})
+}
+
+func newOIDCService(t *testing.T, idp *stubIdP) (service.Service, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+	svc := service.NewService(repository.NewRepository(db), &config.Config{
+		JWTSecret:        "test-secret",
+		OIDCIssuer:       idp.srv.URL,
+		OIDCClientID:     stubClientID,
+		OIDCClientSecret: stubClientSecret,
+		OIDCRedirectURL:  stubRedirectURL,
+	})
+	return svc, mock
+}
+
+func expectNoIdentity(mock sqlmock.Sqlmock, issuer, subject string) {
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM user_identities i`)).
+		WithArgs(issuer, subject).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}))
+}
+
+func TestOIDCLogin_NewUser(t *testing.T) {
+	idp := newStubIdP(t)
+	svc, mock := newOIDCService(t, idp)
+
+	start, err := svc.StartOIDCLogin()
+	require.NoError(t, err)
+	state := mustQuery(t, start.AuthURL, "state")
+	code := idp.authorize(start.AuthURL, "sub-123", "alice")
+
+	// Пользователь и привязка создаются в одной транзакции.
+	expectNoIdentity(mock, idp.srv.URL, "sub-123")
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO users (username, password, coins) VALUES ($1, $2, 1000) RETURNING id`)).
+		WithArgs("alice", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO coin_transactions (from_user_id, to_user_id, amount, kind, order_id, memo)`)).
+		WithArgs(nil, 7, 1000, "grant", nil, "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO ledger_postings (transaction_id, user_id, system_account, amount)`)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO user_identities (issuer, subject, user_id)`)).
+		WithArgs(idp.srv.URL, "sub-123", 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	expectNoTOTP(mock, 7)
+	expectSession(mock, 7, 1)
+
+	resp, err := svc.FinishOIDCLogin(start.StateToken, state, code)
+	require.NoError(t, err)
+	claims, err := svc.ParseAccessToken(resp.Token)
+	require.NoError(t, err)
+	assert.Equal(t, 7, claims.UserID)
+	assert.NotEmpty(t, resp.RefreshToken)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOIDCLogin_LinkedIdentity(t *testing.T) {
+	idp := newStubIdP(t)
+	svc, mock := newOIDCService(t, idp)
+
+	start, err := svc.StartOIDCLogin()
+	require.NoError(t, err)
+	// Имя у провайдера сменилось, но привязка идёт по sub.
+	code := idp.authorize(start.AuthURL, "sub-123", "alice.renamed")
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM user_identities i`)).
+		WithArgs(idp.srv.URL, "sub-123").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}).
+			AddRow(7, "alice", "x", 1000, "admin"))
+	expectNoTOTP(mock, 7)
+	expectSession(mock, 7, 2)
+
+	resp, err := svc.FinishOIDCLogin(start.StateToken, mustQuery(t, start.AuthURL, "state"), code)
+	require.NoError(t, err)
+	claims, err := svc.ParseAccessToken(resp.Token)
+	require.NoError(t, err)
+	assert.Equal(t, "admin", claims.Role)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOIDCLogin_RequiresSecondFactor(t *testing.T) {
+	idp := newStubIdP(t)
+	svc, mock := newOIDCService(t, idp)
+
+	start, err := svc.StartOIDCLogin()
+	require.NoError(t, err)
+	code := idp.authorize(start.AuthURL, "sub-123", "alice")
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM user_identities i`)).
+		WithArgs(idp.srv.URL, "sub-123").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}).
+			AddRow(7, "alice", "x", 1000, "employee"))
+	expectTOTP(mock, 7, rfcSecret, true, 0)
+
+	resp, err := svc.FinishOIDCLogin(start.StateToken, mustQuery(t, start.AuthURL, "state"), code)
+	require.NoError(t, err)
+	assert.True(t, resp.MFARequired)
+	assert.NotEmpty(t, resp.MFAToken)
+	assert.Empty(t, resp.Token)
+	assert.Empty(t, resp.RefreshToken)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOIDCLogin_ExistingAccountNotLinked(t *testing.T) {
+	idp := newStubIdP(t)
+	svc, mock := newOIDCService(t, idp)
+
+	// Имя у провайдера совпадает с существующим аккаунтом (в том числе
+	// админским или парольным) — вход отклоняется, привязка не создаётся.
+	for _, name := range []string{"admin", "alice"} {
+		start, err := svc.StartOIDCLogin()
+		require.NoError(t, err)
+		code := idp.authorize(start.AuthURL, "sub-"+name, name)
+
+		expectNoIdentity(mock, idp.srv.URL, "sub-"+name)
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO users (username, password, coins) VALUES ($1, $2, 1000) RETURNING id`)).
+			WithArgs(name, sqlmock.AnyArg()).
+			WillReturnError(&pq.Error{Code: "23505"})
+		mock.ExpectRollback()
+		expectNoIdentity(mock, idp.srv.URL, "sub-"+name)
+
+		_, err = svc.FinishOIDCLogin(start.StateToken, mustQuery(t, start.AuthURL, "state"), code)
+		assert.Equal(t, service.ErrOIDCAccountExists, err, name)
+	}
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOIDCLink_ExistingAccount(t *testing.T) {
+	idp := newStubIdP(t)
+	svc, mock := newOIDCService(t, idp)
+
+	// Владелец аккаунта начинает привязку из своей сессии; имя у
+	// провайдера роли не играет.
+	start, err := svc.StartOIDCLink(5)
+	require.NoError(t, err)
+	code := idp.authorize(start.AuthURL, "sub-5", "a.smith")
+
+	mock.ExpectBegin()
+	expectNoIdentity(mock, idp.srv.URL, "sub-5")
+	expectUserByID(mock, 5, "alice")
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO user_identities (issuer, subject, user_id)`)).
+		WithArgs(idp.srv.URL, "sub-5", 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO audit_log`)).
+		WithArgs(5, "user.oidc_link", "alice", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	expectNoTOTP(mock, 5)
+	expectSession(mock, 5, 1)
+
+	resp, err := svc.FinishOIDCLogin(start.StateToken, mustQuery(t, start.AuthURL, "state"), code)
+	require.NoError(t, err)
+	claims, err := svc.ParseAccessToken(resp.Token)
+	require.NoError(t, err)
+	assert.Equal(t, 5, claims.UserID)
+	assert.Equal(t, "alice", claims.Username)
+
+	// Учётная запись, уже привязанная к другому пользователю, не
+	// перепривязывается.
+	start, err = svc.StartOIDCLink(5)
+	require.NoError(t, err)
+	code = idp.authorize(start.AuthURL, "sub-9", "bob")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM user_identities i`)).
+		WithArgs(idp.srv.URL, "sub-9").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}).
+			AddRow(9, "bob", "x", 1000, "employee"))
+	mock.ExpectRollback()
+
+	_, err = svc.FinishOIDCLogin(start.StateToken, mustQuery(t, start.AuthURL, "state"), code)
+	assert.Equal(t, service.ErrOIDCIdentityLinked, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOIDCLogin_Rejected(t *testing.T) {
+	idp := newStubIdP(t)
+	svc, mock := newOIDCService(t, idp)
+
+	start, err := svc.StartOIDCLogin()
+	require.NoError(t, err)
+	state := mustQuery(t, start.AuthURL, "state")
+
+	// Чужой state.
+	code := idp.authorize(start.AuthURL, "sub-1", "alice")
+	_, err = svc.FinishOIDCLogin(start.StateToken, "forged", code)
+	assert.Equal(t, service.ErrInvalidOIDCState, err)
+	_, err = svc.FinishOIDCLogin("garbage", state, code)
+	assert.Equal(t, service.ErrInvalidOIDCState, err)
+
+	// Code от другого входа: PKCE verifier не совпадает.
+	other, err := svc.StartOIDCLogin()
+	require.NoError(t, err)
+	code = idp.authorize(other.AuthURL, "sub-1", "alice")
+	_, err = svc.FinishOIDCLogin(start.StateToken, state, code)
+	assert.ErrorIs(t, err, service.ErrOIDCLoginFailed)
+
+	cases := []jwt.MapClaims{
+		{"nonce": "other-nonce"},
+		{"aud": "someone-else"},
+		{"iss": "https://evil.example"},
+		{"exp": time.Now().Add(-time.Minute).Unix()},
+	}
+	for _, extra := range cases {
+		idp.extra = extra
+		code = idp.authorize(start.AuthURL, "sub-1", "alice")
+		_, err = svc.FinishOIDCLogin(start.StateToken, state, code)
+		assert.ErrorIs(t, err, service.ErrOIDCLoginFailed, "%v", extra)
+	}
+
+	// Токен, подписанный не ключом провайдера.
+	idp.extra = nil
+	_, idp.key, _ = ed25519.GenerateKey(rand.Reader)
+	code = idp.authorize(start.AuthURL, "sub-1", "alice")
+	_, err = svc.FinishOIDCLogin(start.StateToken, state, code)
+	assert.ErrorIs(t, err, service.ErrOIDCLoginFailed)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestOIDCLogin_Disabled(t *testing.T) {
+	svc := service.NewService(nil, &config.Config{JWTSecret: "test-secret"})
+	_, err := svc.StartOIDCLogin()
+	assert.Equal(t, service.ErrOIDCDisabled, err)
+}
+
+func mustQuery(t *testing.T, rawURL, key string) string {
+	u, err := url.Parse(rawURL)
+	require.NoError(t, err)
+	v := u.Query().Get(key)
+	require.NotEmpty(t, v)
+	return v
+}
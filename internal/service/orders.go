@@ -0,0 +1,230 @@
+package service
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"avito-shop/internal/models"
+	"avito-shop/internal/repository"
+)
+
+var (
+	ErrOrderNotFound      = errors.New("order not found")
+	ErrInvalidOrderStatus = errors.New("invalid order status")
+	ErrOrderTransition    = errors.New("order status transition is not allowed")
+	ErrOrderNotCancelable = errors.New("order can no longer be cancelled")
+	ErrRefundWindowClosed = errors.New("refund window has expired")
+)
+
+const (
+	auditOrderStatus = "order.status"
+	auditOrderRefund = "order.refund"
+)
+
+// orderTransitions — допустимые переходы статуса заказа.
+// delivered и cancelled — конечные состояния.
+var orderTransitions = map[string][]string{
+	models.OrderPlaced:         {models.OrderReadyForPickup, models.OrderCancelled},
+	models.OrderReadyForPickup: {models.OrderDelivered, models.OrderCancelled},
+}
+
+var orderStatuses = map[string]bool{
+	models.OrderPlaced:         true,
+	models.OrderReadyForPickup: true,
+	models.OrderDelivered:      true,
+	models.OrderCancelled:      true,
+}
+
+// ----------------------------------------
+// ListOrders
+// ----------------------------------------
+
+func (s *service) ListOrders(userID int) ([]models.OrderInfo, error) {
+	orders, err := s.repo.GetOrdersByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.orderInfos(s.repo, orders)
+}
+
+func (s *service) AdminListOrders(status string) ([]models.OrderInfo, error) {
+	if status != "" && !orderStatuses[status] {
+		return nil, ErrInvalidOrderStatus
+	}
+	orders, err := s.repo.GetOrdersByStatus(status)
+	if err != nil {
+		return nil, err
+	}
+	return s.orderInfos(s.repo, orders)
+}
+
+// ----------------------------------------
+// SetOrderStatus
+// ----------------------------------------
+
+func (s *service) SetOrderStatus(adminID, orderID int, status string) (*models.OrderInfo, error) {
+	if !orderStatuses[status] {
+		return nil, ErrInvalidOrderStatus
+	}
+
+	var info *models.OrderInfo
+	err := s.repo.WithTx(func(repo repository.Repository) error {
+		order, err := repo.GetOrderByIDForUpdate(orderID)
+		if err != nil {
+			return err
+		}
+		if order == nil {
+			return ErrOrderNotFound
+		}
+		if !canTransition(order.Status, status) {
+			return ErrOrderTransition
+		}
+
+		if status == models.OrderCancelled {
+			if err := refundOrder(repo, order); err != nil {
+				return err
+			}
+		} else if err := repo.UpdateOrderStatus(order.ID, status); err != nil {
+			return err
+		}
+		order.Status = status
+
+		if err := writeAudit(repo, adminID, auditOrderStatus, strconv.Itoa(order.ID), models.OrderStatusRequest{Status: status}); err != nil {
+			return err
+		}
+
+		infos, err := s.orderInfos(repo, []models.Order{*order})
+		if err != nil {
+			return err
+		}
+		info = &infos[0]
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// ----------------------------------------
+// CancelOrder
+// ----------------------------------------
+
+// CancelOrder — отмена заказа самим покупателем: только пока заказ не выдан
+// и не истекло cfg.RefundWindow с момента покупки.
+func (s *service) CancelOrder(userID, orderID int) (*models.OrderInfo, error) {
+	var info *models.OrderInfo
+	err := s.repo.WithTx(func(repo repository.Repository) error {
+		order, err := repo.GetOrderByIDForUpdate(orderID)
+		if err != nil {
+			return err
+		}
+		// Чужой заказ не отличаем от несуществующего
+		if order == nil || order.UserID != userID {
+			return ErrOrderNotFound
+		}
+		if !canTransition(order.Status, models.OrderCancelled) {
+			return ErrOrderNotCancelable
+		}
+		if time.Since(order.CreatedAt) > s.cfg.RefundWindow {
+			return ErrRefundWindowClosed
+		}
+
+		if err := refundOrder(repo, order); err != nil {
+			return err
+		}
+		if err := writeAudit(repo, userID, auditOrderRefund, strconv.Itoa(order.ID), nil); err != nil {
+			return err
+		}
+
+		infos, err := s.orderInfos(repo, []models.Order{*order})
+		if err != nil {
+			return err
+		}
+		info = &infos[0]
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// refundOrder отменяет заблокированный заказ: возвращает монеты покупателю,
+// единицы товара — на склад, и пишет в coin_transactions возврат от магазина.
+// Позиции отменённого заказа перестают учитываться в инвентаре GetInfo.
+func refundOrder(repo repository.Repository, order *models.Order) error {
+	lines, err := repo.GetOrderLines([]int{order.ID})
+	if err != nil {
+		return err
+	}
+	for _, l := range lines {
+		if err := repo.IncrementItemStock(l.ItemName, l.Quantity); err != nil {
+			return err
+		}
+	}
+	if err := repo.AddUserCoins(order.UserID, order.Total); err != nil {
+		return err
+	}
+	if err := repo.UpdateOrderStatus(order.ID, models.OrderCancelled); err != nil {
+		return err
+	}
+	refund := models.CoinTransaction{
+		ToUserID: &order.UserID,
+		Amount:   order.Total,
+		Kind:     models.TxRefund,
+		OrderID:  &order.ID,
+	}
+	if err := repo.InsertCoinTransaction(refund); err != nil {
+		return err
+	}
+	order.Status = models.OrderCancelled
+	return nil
+}
+
+func canTransition(from, to string) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// orderInfos подтягивает позиции заказов одним запросом.
+func (s *service) orderInfos(repo repository.Repository, orders []models.Order) ([]models.OrderInfo, error) {
+	ids := make([]int, 0, len(orders))
+	for _, o := range orders {
+		ids = append(ids, o.ID)
+	}
+	lines, err := repo.GetOrderLines(ids)
+	if err != nil {
+		return nil, err
+	}
+	byOrder := make(map[int][]models.InvItem, len(orders))
+	for _, l := range lines {
+		if l.OrderID == nil {
+			continue
+		}
+		byOrder[*l.OrderID] = append(byOrder[*l.OrderID], models.InvItem{Type: l.ItemName, Quantity: l.Quantity})
+	}
+
+	result := make([]models.OrderInfo, 0, len(orders))
+	for _, o := range orders {
+		items := byOrder[o.ID]
+		if items == nil {
+			items = []models.InvItem{}
+		}
+		result = append(result, models.OrderInfo{
+			ID:        o.ID,
+			UserID:    o.UserID,
+			Status:    o.Status,
+			Total:     o.Total,
+			Items:     items,
+			CreatedAt: o.CreatedAt,
+			UpdatedAt: o.UpdatedAt,
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,246 @@
+package service_test
+
+import (
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"avito-shop/internal/config"
+	"avito-shop/internal/models"
+	"avito-shop/internal/repository"
+	"avito-shop/internal/service"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	orderColumns    = []string{"id", "user_id", "total", "status", "created_at", "updated_at"}
+	purchaseColumns = []string{"id", "user_id", "item_name", "quantity", "order_id", "created_at"}
+)
+
+func TestListOrders_WithLines(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+	now := time.Now()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM orders WHERE user_id = $1`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(orderColumns).
+			AddRow(8, 1, 300, "ready_for_pickup", now, now).
+			AddRow(7, 1, 120, "delivered", now, now))
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM item_purchases WHERE order_id = ANY($1)`)).
+		WithArgs(pq.Array([]int{8, 7})).
+		WillReturnRows(sqlmock.NewRows(purchaseColumns).
+			AddRow(1, 1, "cup", 2, 7, now).
+			AddRow(2, 1, "t-shirt", 1, 7, now).
+			AddRow(3, 1, "hoody", 1, 8, now))
+
+	orders, err := svc.ListOrders(1)
+	require.NoError(t, err)
+	require.Len(t, orders, 2)
+	assert.Equal(t, models.OrderReadyForPickup, orders[0].Status)
+	assert.Equal(t, []models.InvItem{{Type: "hoody", Quantity: 1}}, orders[0].Items)
+	assert.Len(t, orders[1].Items, 2)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSetOrderStatus_Advance(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM orders WHERE id = $1 FOR UPDATE`)).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows(orderColumns).AddRow(7, 1, 120, "placed", now, now))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE orders SET status = $1, updated_at = NOW() WHERE id = $2`)).
+		WithArgs("ready_for_pickup", 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO audit_log`)).
+		WithArgs(99, "order.status", "7", `{"status":"ready_for_pickup"}`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM item_purchases WHERE order_id = ANY($1)`)).
+		WithArgs(pq.Array([]int{7})).
+		WillReturnRows(sqlmock.NewRows(purchaseColumns).AddRow(1, 1, "cup", 2, 7, now))
+	mock.ExpectCommit()
+
+	order, err := svc.SetOrderStatus(99, 7, models.OrderReadyForPickup)
+	require.NoError(t, err)
+	assert.Equal(t, models.OrderReadyForPickup, order.Status)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSetOrderStatus_InvalidTransition(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM orders WHERE id = $1 FOR UPDATE`)).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows(orderColumns).AddRow(7, 1, 120, "delivered", now, now))
+	mock.ExpectRollback()
+
+	_, err = svc.SetOrderStatus(99, 7, models.OrderPlaced)
+	assert.ErrorIs(t, err, service.ErrOrderTransition)
+
+	_, err = svc.SetOrderStatus(99, 7, "lost")
+	assert.ErrorIs(t, err, service.ErrInvalidOrderStatus)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSetOrderStatus_NotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM orders WHERE id = $1 FOR UPDATE`)).
+		WithArgs(404).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	_, err = svc.SetOrderStatus(99, 404, models.OrderDelivered)
+	assert.ErrorIs(t, err, service.ErrOrderNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func expectRefund(mock sqlmock.Sqlmock, now time.Time) {
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM item_purchases WHERE order_id = ANY($1)`)).
+		WithArgs(pq.Array([]int{7})).
+		WillReturnRows(sqlmock.NewRows(purchaseColumns).AddRow(1, 1, "pink-hoody", 1, 7, now))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE items SET stock = stock + $1 WHERE name = $2 AND stock IS NOT NULL`)).
+		WithArgs(1, "pink-hoody").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET coins = coins + $1 WHERE id = $2`)).
+		WithArgs(500, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE orders SET status = $1, updated_at = NOW() WHERE id = $2`)).
+		WithArgs("cancelled", 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO coin_transactions (from_user_id, to_user_id, amount, kind, order_id, memo)`)).
+		WithArgs(nil, 1, 500, "refund", 7, "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(42))
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO ledger_postings (transaction_id, user_id, system_account, amount)`)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+}
+
+func TestCancelOrder_ByBuyerWithinWindow(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{RefundWindow: time.Hour})
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM orders WHERE id = $1 FOR UPDATE`)).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows(orderColumns).AddRow(7, 1, 500, "placed", now.Add(-10*time.Minute), now))
+	expectRefund(mock, now)
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO audit_log`)).
+		WithArgs(1, "order.refund", "7", "").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM item_purchases WHERE order_id = ANY($1)`)).
+		WithArgs(pq.Array([]int{7})).
+		WillReturnRows(sqlmock.NewRows(purchaseColumns).AddRow(1, 1, "pink-hoody", 1, 7, now))
+	mock.ExpectCommit()
+
+	order, err := svc.CancelOrder(1, 7)
+	require.NoError(t, err)
+	assert.Equal(t, models.OrderCancelled, order.Status)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCancelOrder_WindowExpired(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{RefundWindow: time.Hour})
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM orders WHERE id = $1 FOR UPDATE`)).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows(orderColumns).AddRow(7, 1, 500, "placed", now.Add(-2*time.Hour), now))
+	mock.ExpectRollback()
+
+	_, err = svc.CancelOrder(1, 7)
+	assert.ErrorIs(t, err, service.ErrRefundWindowClosed)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCancelOrder_DeliveredOrForeign(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{RefundWindow: time.Hour})
+	now := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM orders WHERE id = $1 FOR UPDATE`)).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows(orderColumns).AddRow(7, 1, 500, "delivered", now, now))
+	mock.ExpectRollback()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM orders WHERE id = $1 FOR UPDATE`)).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows(orderColumns).AddRow(7, 1, 500, "placed", now, now))
+	mock.ExpectRollback()
+
+	_, err = svc.CancelOrder(1, 7)
+	assert.ErrorIs(t, err, service.ErrOrderNotCancelable)
+
+	_, err = svc.CancelOrder(2, 7)
+	assert.ErrorIs(t, err, service.ErrOrderNotFound)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSetOrderStatus_AdminCancelRefunds(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+	now := time.Now()
+
+	// Администратор отменяет заказ без ограничения по окну возврата
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM orders WHERE id = $1 FOR UPDATE`)).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows(orderColumns).AddRow(7, 1, 500, "ready_for_pickup", now.Add(-72*time.Hour), now))
+	expectRefund(mock, now)
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO audit_log`)).
+		WithArgs(99, "order.status", "7", `{"status":"cancelled"}`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM item_purchases WHERE order_id = ANY($1)`)).
+		WithArgs(pq.Array([]int{7})).
+		WillReturnRows(sqlmock.NewRows(purchaseColumns).AddRow(1, 1, "pink-hoody", 1, 7, now))
+	mock.ExpectCommit()
+
+	order, err := svc.SetOrderStatus(99, 7, models.OrderCancelled)
+	require.NoError(t, err)
+	assert.Equal(t, models.OrderCancelled, order.Status)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"avito-shop/internal/models"
+	"avito-shop/internal/repository"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+
+const (
+	defaultPasswordResetTTL = time.Hour
+	auditPasswordReset      = "user.password_reset"
+)
+
+// ----------------------------------------
+// ChangePassword
+// ----------------------------------------
+
+// ChangePassword меняет пароль по текущему. Все сессии пользователя
+// завершаются, а token_version увеличивается, так что старые access-токены
+// перестают действовать; вызывающему выдаётся новая пара токенов.
+// Неверный текущий пароль считается в лимиты входа, как в AuthUser.
+func (s *service) ChangePassword(userID int, currentPassword, newPassword string) (*models.AuthResponse, error) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	attempt, err := s.beginLoginAttempt(user.Username, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(currentPassword)); err != nil {
+		return nil, ErrInvalidPassword
+	}
+	if err := s.loginSucceeded(attempt); err != nil {
+		return nil, err
+	}
+	if err := validatePassword(user.Username, newPassword); err != nil {
+		return nil, err
+	}
+
+	if err := s.setPassword(s.repo, user.ID, newPassword); err != nil {
+		return nil, err
+	}
+	return s.issueTokens(user.ID, user.Username, user.Role)
+}
+
+// setPassword записывает новый хэш и отзывает все сессии и API-ключи
+// пользователя: после сброса пароля из-за компрометации ни один выданный
+// ранее доступ не должен работать.
+func (s *service) setPassword(repo repository.Repository, userID int, password string) error {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return repo.WithTx(func(repo repository.Repository) error {
+		if err := repo.UpdateUserPassword(userID, string(hashed)); err != nil {
+			return err
+		}
+		if err := repo.BumpTokenVersion(userID); err != nil {
+			return err
+		}
+		if err := repo.RevokeAllAuthSessions(userID); err != nil {
+			return err
+		}
+		return repo.RevokeAllAPIKeys(userID)
+	})
+}
+
+// ----------------------------------------
+// Reset
+// ----------------------------------------
+
+// CreatePasswordReset выпускает одноразовый токен сброса пароля. В БД
+// хранится только его хэш; админ передаёт токен пользователю сам.
+func (s *service) CreatePasswordReset(adminID int, username string) (*models.PasswordResetResponse, error) {
+	username = strings.TrimSpace(username)
+	user, err := s.repo.GetUserByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	token, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	// expires_at — TIMESTAMP без часового пояса, хранится в UTC.
+	expiresAt := s.now().Add(s.passwordResetTTL()).UTC()
+	err = s.repo.WithTx(func(repo repository.Repository) error {
+		if err := repo.InsertPasswordResetToken(user.ID, hashToken(token), expiresAt, adminID); err != nil {
+			return err
+		}
+		return writeAudit(repo, adminID, auditPasswordReset, user.Username, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &models.PasswordResetResponse{ResetToken: token, ExpiresAt: expiresAt}, nil
+}
+
+// ResetPassword задаёт новый пароль по токену из CreatePasswordReset.
+// Токен гасится, сессии пользователя отзываются, блокировка входа
+// снимается.
+func (s *service) ResetPassword(resetToken, newPassword string) error {
+	if resetToken == "" {
+		return ErrInvalidResetToken
+	}
+
+	var username string
+	err := s.repo.WithTx(func(repo repository.Repository) error {
+		t, err := repo.GetPasswordResetTokenForUpdate(hashToken(resetToken))
+		if err != nil {
+			return err
+		}
+		if t == nil || t.UsedAt != nil || !s.now().Before(t.ExpiresAt) {
+			return ErrInvalidResetToken
+		}
+		user, err := repo.GetUserByID(t.UserID)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			return ErrInvalidResetToken
+		}
+		if err := validatePassword(user.Username, newPassword); err != nil {
+			return err
+		}
+		if err := repo.MarkPasswordResetTokenUsed(t.ID); err != nil {
+			return err
+		}
+		username = user.Username
+		return s.setPassword(repo, user.ID, newPassword)
+	})
+	if err != nil {
+		return err
+	}
+	return s.attempts.Reset(userAttemptKey(username))
+}
+
+// PurgeExpiredPasswordResets удаляет истёкшие и использованные токены сброса.
+func (s *service) PurgeExpiredPasswordResets() (int64, error) {
+	return s.repo.DeleteExpiredPasswordResetTokens()
+}
+
+func (s *service) passwordResetTTL() time.Duration {
+	if s.cfg.PasswordResetTTL > 0 {
+		return s.cfg.PasswordResetTTL
+	}
+	return defaultPasswordResetTTL
+}
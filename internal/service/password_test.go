@@ -0,0 +1,213 @@
+package service_test
+
+import (
+	"database/sql/driver"
+	"regexp"
+	"testing"
+	"time"
+
+	"avito-shop/internal/config"
+	"avito-shop/internal/repository"
+	"avito-shop/internal/service"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// captureArg принимает любое значение и запоминает его.
+type captureArg struct{ value driver.Value }
+
+func (c *captureArg) Match(v driver.Value) bool {
+	c.value = v
+	return true
+}
+
+func expectUserWithPassword(mock sqlmock.Sqlmock, userID int, username, password string) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins, role FROM users WHERE id = $1`)).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}).
+			AddRow(userID, username, string(hash), 1000, "employee"))
+}
+
+// expectSetPassword — новый хэш плюс отзыв всех сессий и API-ключей.
+func expectSetPassword(mock sqlmock.Sqlmock, userID int, newPassword string) {
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET password = $1 WHERE id = $2`)).
+		WithArgs(bcryptOf(newPassword), userID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET token_version = token_version + 1 WHERE id = $1`)).
+		WithArgs(userID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE auth_sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`)).
+		WithArgs(userID).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE api_keys SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`)).
+		WithArgs(userID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+// bcryptOf совпадает с любым bcrypt-хэшем пароля password.
+type bcryptOf string
+
+func (p bcryptOf) Match(v driver.Value) bool {
+	hash, ok := v.(string)
+	return ok && bcrypt.CompareHashAndPassword([]byte(hash), []byte(p)) == nil
+}
+
+func TestChangePassword_OK(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{JWTSecret: "test-secret"})
+
+	expectUserWithPassword(mock, 1, "alice", "OldPass123")
+	mock.ExpectBegin()
+	expectSetPassword(mock, 1, "NewPass456")
+	mock.ExpectCommit()
+	expectSession(mock, 1, 4)
+
+	resp, err := svc.ChangePassword(1, "OldPass123", "NewPass456")
+	require.NoError(t, err)
+	assert.NotEmpty(t, resp.Token)
+	assert.NotEmpty(t, resp.RefreshToken)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestChangePassword_Rejected(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{JWTSecret: "test-secret"})
+
+	expectUserWithPassword(mock, 1, "alice", "OldPass123")
+	_, err = svc.ChangePassword(1, "wrong", "NewPass456")
+	assert.Equal(t, service.ErrInvalidPassword, err)
+
+	expectUserWithPassword(mock, 1, "alice", "OldPass123")
+	_, err = svc.ChangePassword(1, "OldPass123", "short")
+	assert.Equal(t, service.ErrWeakPassword, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPasswordReset_Flow(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	clock := newFakeClock()
+	svc := service.NewService(repository.NewRepository(db),
+		&config.Config{JWTSecret: "test-secret", PasswordResetTTL: 30 * time.Minute},
+		service.WithClock(clock.Now))
+
+	stored := &captureArg{}
+	expiresAt := clock.Now().Add(30 * time.Minute)
+	expectUserByName(mock, "alice", "")
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO password_reset_tokens (user_id, token_hash, expires_at, created_by)`)).
+		WithArgs(1, stored, expiresAt, 99).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO audit_log`)).
+		WithArgs(99, "user.password_reset", "alice", "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	reset, err := svc.CreatePasswordReset(99, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, expiresAt, reset.ExpiresAt)
+	// В БД только хэш.
+	assert.Equal(t, sha(reset.ResetToken), stored.value)
+
+	resetColumns := []string{"id", "user_id", "expires_at", "used_at"}
+
+	// Слабый пароль — токен не гасится.
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, user_id, expires_at, used_at FROM password_reset_tokens`)).
+		WithArgs(sha(reset.ResetToken)).
+		WillReturnRows(sqlmock.NewRows(resetColumns).AddRow(5, 1, expiresAt, nil))
+	expectUserByID(mock, 1, "alice")
+	mock.ExpectRollback()
+	assert.Equal(t, service.ErrWeakPassword, svc.ResetPassword(reset.ResetToken, "alice"))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, user_id, expires_at, used_at FROM password_reset_tokens`)).
+		WithArgs(sha(reset.ResetToken)).
+		WillReturnRows(sqlmock.NewRows(resetColumns).AddRow(5, 1, expiresAt, nil))
+	expectUserByID(mock, 1, "alice")
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE password_reset_tokens SET used_at = NOW() WHERE id = $1`)).
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectSetPassword(mock, 1, "NewPass456")
+	mock.ExpectCommit()
+	require.NoError(t, svc.ResetPassword(reset.ResetToken, "NewPass456"))
+
+	// Повторно токен не принимается.
+	usedAt := clock.Now()
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, user_id, expires_at, used_at FROM password_reset_tokens`)).
+		WithArgs(sha(reset.ResetToken)).
+		WillReturnRows(sqlmock.NewRows(resetColumns).AddRow(5, 1, expiresAt, usedAt))
+	mock.ExpectRollback()
+	assert.Equal(t, service.ErrInvalidResetToken, svc.ResetPassword(reset.ResetToken, "NewPass789"))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreatePasswordReset_ExpiryInUTC(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	// 15:00 по Москве — 12:00 UTC.
+	clock := &fakeClock{t: time.Date(2024, 3, 1, 15, 0, 0, 0, time.FixedZone("MSK", 3*60*60))}
+	svc := service.NewService(repository.NewRepository(db),
+		&config.Config{JWTSecret: "test-secret", PasswordResetTTL: 30 * time.Minute},
+		service.WithClock(clock.Now))
+
+	expiresAt := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	expectUserByName(mock, "alice", "")
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO password_reset_tokens (user_id, token_hash, expires_at, created_by)`)).
+		WithArgs(1, sqlmock.AnyArg(), expiresAt, 99).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO audit_log`)).
+		WithArgs(99, "user.password_reset", "alice", "").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	_, err = svc.CreatePasswordReset(99, "alice")
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestResetPassword_Expired(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	clock := newFakeClock()
+	svc := service.NewService(repository.NewRepository(db), &config.Config{JWTSecret: "test-secret"},
+		service.WithClock(clock.Now))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, user_id, expires_at, used_at FROM password_reset_tokens`)).
+		WithArgs(sha("token")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "expires_at", "used_at"}).
+			AddRow(5, 1, clock.Now().Add(-time.Second), nil))
+	mock.ExpectRollback()
+	assert.Equal(t, service.ErrInvalidResetToken, svc.ResetPassword("token", "NewPass456"))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, user_id, expires_at, used_at FROM password_reset_tokens`)).
+		WithArgs(sha("unknown")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "expires_at", "used_at"}))
+	mock.ExpectRollback()
+	assert.Equal(t, service.ErrInvalidResetToken, svc.ResetPassword("unknown", "NewPass456"))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"avito-shop/internal/models"
+	"avito-shop/internal/repository"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidUsername = errors.New("username must be 3-32 characters: latin letters, digits, '.', '_' or '-'")
+	ErrWeakPassword    = errors.New("password must be 8-72 bytes long, contain a letter and a digit and differ from the username")
+	ErrUsernameTaken   = errors.New("username is already taken")
+)
+
+var usernameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{2,31}$`)
+
+const (
+	minPasswordLength = 8
+	// bcrypt учитывает только первые 72 байта пароля.
+	maxPasswordLength = 72
+)
+
+// ----------------------------------------
+// Register
+// ----------------------------------------
+
+// Register создаёт аккаунт с проверкой имени и пароля и сразу открывает
+// сессию. Доступен в любом режиме регистрации.
+func (s *service) Register(username, password string) (*models.AuthResponse, error) {
+	username = strings.TrimSpace(username)
+	if !usernameRe.MatchString(username) {
+		return nil, ErrInvalidUsername
+	}
+	if err := validatePassword(username, password); err != nil {
+		return nil, err
+	}
+
+	userID, err := s.createAccount(username, password)
+	if err != nil {
+		return nil, err
+	}
+	return s.issueTokens(userID, username, models.RoleEmployee)
+}
+
+// createAccount заводит пользователя со стартовым балансом.
+func (s *service) createAccount(username, password string) (int, error) {
+	hashedPass, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, err
+	}
+
+	var userID int
+	err = s.repo.WithTx(func(repo repository.Repository) error {
+		userID, err = insertAccount(repo, username, string(hashedPass))
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// insertAccount создаёт пользователя и начисляет стартовый баланс в
+// транзакции repo.
+func insertAccount(repo repository.Repository, username, hashedPass string) (int, error) {
+	userID, err := repo.CreateUser(username, hashedPass)
+	if err != nil {
+		if err == repository.ErrAlreadyExists {
+			return 0, ErrUsernameTaken
+		}
+		return 0, err
+	}
+	// Стартовый баланс — эмиссия из treasury, чтобы журнал сходился с users.coins
+	err = repo.InsertCoinTransaction(models.CoinTransaction{
+		ToUserID: &userID,
+		Amount:   startingBalance,
+		Kind:     models.TxGrant,
+	})
+	return userID, err
+}
+
+func validatePassword(username, password string) error {
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return ErrWeakPassword
+	}
+	if strings.EqualFold(password, username) {
+		return ErrWeakPassword
+	}
+	var hasLetter, hasDigit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	if !hasLetter || !hasDigit {
+		return ErrWeakPassword
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package service_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"avito-shop/internal/config"
+	"avito-shop/internal/repository"
+	"avito-shop/internal/service"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func expectCreateUser(mock sqlmock.Sqlmock, username string, userID int) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO users (username, password, coins) VALUES ($1, $2, 1000) RETURNING id`)).
+		WithArgs(username, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(userID))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO coin_transactions (from_user_id, to_user_id, amount, kind, order_id, memo)`)).
+		WithArgs(nil, userID, 1000, "grant", nil, "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO ledger_postings (transaction_id, user_id, system_account, amount)`)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+}
+
+func TestAuthUser_ExplicitRegistration_UnknownUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{
+		JWTSecret:        "test-secret",
+		RegistrationMode: config.RegistrationExplicit,
+	})
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins, role FROM users WHERE username = $1`)).
+		WithArgs("alcie").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}))
+
+	resp, err := svc.AuthUser("alcie", "secret123", "")
+	assert.Equal(t, service.ErrUserNotFound, err)
+	assert.Nil(t, resp)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRegister_Success(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{
+		JWTSecret:        "test-secret",
+		RegistrationMode: config.RegistrationExplicit,
+	})
+
+	expectCreateUser(mock, "new.user", 100)
+	expectSession(mock, 100, 1)
+
+	resp, err := svc.Register(" new.user ", "correct1horse")
+	require.NoError(t, err)
+	assert.NotEmpty(t, resp.Token)
+	assert.NotEmpty(t, resp.RefreshToken)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRegister_UsernameTaken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{JWTSecret: "test-secret"})
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO users (username, password, coins) VALUES ($1, $2, 1000) RETURNING id`)).
+		WithArgs("alice", sqlmock.AnyArg()).
+		WillReturnError(&pq.Error{Code: "23505"})
+	mock.ExpectRollback()
+
+	_, err = svc.Register("alice", "correct1horse")
+	assert.Equal(t, service.ErrUsernameTaken, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRegister_Policy(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+
+	cases := []struct {
+		username, password string
+		err                error
+	}{
+		{"al", "correct1horse", service.ErrInvalidUsername},
+		{"-alice", "correct1horse", service.ErrInvalidUsername},
+		{"alice smith", "correct1horse", service.ErrInvalidUsername},
+		{strings.Repeat("a", 33), "correct1horse", service.ErrInvalidUsername},
+		{"alice", "short1", service.ErrWeakPassword},
+		{"alice", "nodigitshere", service.ErrWeakPassword},
+		{"alice", "1234567890", service.ErrWeakPassword},
+		{"alice1234", "ALICE1234", service.ErrWeakPassword},
+		{"alice", strings.Repeat("a1", 37), service.ErrWeakPassword},
+	}
+	for _, c := range cases {
+		_, err := svc.Register(c.username, c.password)
+		assert.Equal(t, c.err, err, "%q / %q", c.username, c.password)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
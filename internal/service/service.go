@@ -2,11 +2,14 @@ package service
 
 import (
 	"errors"
+	"math"
+	"sort"
 	"strings"
 	"time"
-	"fmt"
 	"avito-shop/internal/config"
+	"avito-shop/internal/jwtkeys"
 	"avito-shop/internal/models"
+	"avito-shop/internal/oidc"
 	"avito-shop/internal/repository"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -14,75 +17,193 @@ import (
 )
 
 var (
-	ErrUserNotFound    = errors.New("user not found")
-	ErrNotEnoughCoins  = errors.New("not enough coins")
-	ErrInvalidPassword = errors.New("invalid password")
-	ErrInvalidItem     = errors.New("invalid item")
-	ErrNegativeAmount  = errors.New("amount must be positive")
+	ErrUserNotFound      = errors.New("user not found")
+	ErrNotEnoughCoins    = errors.New("not enough coins")
+	ErrInvalidPassword   = errors.New("invalid password")
+	ErrInvalidItem       = errors.New("invalid item")
+	ErrNegativeAmount    = errors.New("amount must be positive")
+	ErrOutOfStock        = errors.New("item is out of stock")
+	ErrInvalidQuantity   = errors.New("quantity must be positive")
+	ErrQuantityTooLarge  = errors.New("quantity is too large")
+	ErrMemoTooLong       = errors.New("memo is too long")
+	ErrEmptyRecipient    = errors.New("empty toUser")
+	ErrRecipientNotFound = errors.New("recipient not found")
 )
 
-var itemPrices = map[string]int{
-    "t-shirt":    80,
-    "cup":        20,
-    "book":       50,
-    "pen":        10,
-    "powerbank":  200,
-    "hoody":      300,
-    "umbrella":   200,
-    "socks":      10,
-    "wallet":     50,
-    "pink-hoody": 500,
-}
+const maxMemoLength = 255
 
 type Service interface {
-    AuthUser(username, password string) (string, error)
+    AuthUser(username, password, clientIP string) (*models.AuthResponse, error)
+    UnlockUser(adminID int, username string) error
+    UnlockIP(adminID int, ip string) error
+    PurgeLoginAttempts() (int64, error)
+
+    EnrollTOTP(userID int) (*models.TOTPEnrollResponse, error)
+    ConfirmTOTP(userID int, code string) (*models.RecoveryCodesResponse, error)
+    DisableTOTP(userID int, code string) error
+    VerifyMFA(mfaToken, code, clientIP string) (*models.AuthResponse, error)
+
+    ChangePassword(userID int, currentPassword, newPassword string) (*models.AuthResponse, error)
+    CreatePasswordReset(adminID int, username string) (*models.PasswordResetResponse, error)
+    ResetPassword(resetToken, newPassword string) error
+    PurgeExpiredPasswordResets() (int64, error)
+
+    CreateAPIKey(userID int, req models.CreateAPIKeyRequest) (*models.CreatedAPIKey, error)
+    ListAPIKeys(userID int) ([]models.APIKeyInfo, error)
+    RevokeAPIKey(userID, keyID int) error
+    AuthenticateAPIKey(secret string) (*models.Principal, error)
+
+    StartOIDCLogin() (*models.OIDCLoginStart, error)
+    StartOIDCLink(userID int) (*models.OIDCLoginStart, error)
+    FinishOIDCLogin(stateToken, state, code string) (*models.AuthResponse, error)
+    Register(username, password string) (*models.AuthResponse, error)
+    RefreshTokens(refreshToken string) (*models.AuthResponse, error)
+    Logout(userID, sessionID int, everywhere bool) error
+    CheckSession(userID, sessionID, tokenVersion int) error
+    ParseAccessToken(token string) (*models.AccessClaims, error)
+    JWKS() jwtkeys.JWKS
+    PurgeExpiredRefreshTokens() (int64, error)
     GetInfo(userID int) (*models.InfoResponse, error)
-    SendCoin(fromUserID int, toUsername string, amount int) error
-    BuyItem(userID int, itemName string) error
+    GetInfoAggregated(userID int) (*models.AggregatedInfoResponse, error)
+    SendCoin(fromUserID int, toUsername string, amount int, memo string) error
+    BuyItem(userID int, itemName string, quantity int) error
+    ListItems() ([]models.CatalogItem, error)
+
+    GetCart(userID int) (*models.CartResponse, error)
+    AddToCart(userID int, itemName string, quantity int) error
+    RemoveFromCart(userID int, itemName string) error
+    ClearCart(userID int) error
+    Checkout(userID int) (*models.CheckoutResponse, error)
+
+    ListOrders(userID int) ([]models.OrderInfo, error)
+    AdminListOrders(status string) ([]models.OrderInfo, error)
+    SetOrderStatus(adminID, orderID int, status string) (*models.OrderInfo, error)
+    CancelOrder(userID, orderID int) (*models.OrderInfo, error)
+
+    ListTransactions(userID int, q models.TransactionQuery) (*models.TransactionsResponse, error)
+
+    LedgerBalance(userID int) (int, error)
+    Reconcile(repair bool) (*models.ReconciliationReport, error)
+
+    Idempotent(userID int, key, fingerprint string, op func(svc Service) error, render func(opErr error) (resp models.IdempotentResponse, store bool)) (*models.IdempotentResponse, bool, error)
+    PurgeExpiredIdempotencyKeys() (int64, error)
+
+    CreateItem(adminID int, req models.CreateItemRequest) (*models.AdminItem, error)
+    UpdateItem(adminID int, name string, req models.UpdateItemRequest) (*models.AdminItem, error)
+    RetireItem(adminID int, name string) error
+    RestockItem(adminID int, name string, quantity int) (*models.AdminItem, error)
+    SetItemStock(adminID int, name string, stock *int) (*models.AdminItem, error)
 }
 
 type service struct {
-    repo repository.Repository
-    cfg  *config.Config
+    repo     repository.Repository
+    cfg      *config.Config
+    catalog  *catalog
+    keys     *jwtkeys.KeySet
+    attempts repository.LoginAttemptStore
+    now      func() time.Time
+    // oidc — nil, если вход через OIDC не настроен.
+    oidc *oidc.Provider
+}
+
+// Option меняет зависимость сервиса, заданную по умолчанию.
+type Option func(*service)
+
+// WithLoginAttemptStore задаёт хранилище неудачных входов; по умолчанию —
+// в памяти процесса.
+func WithLoginAttemptStore(store repository.LoginAttemptStore) Option {
+    return func(s *service) { s.attempts = store }
 }
 
-func NewService(repo repository.Repository, cfg *config.Config) Service {
-    return &service{repo: repo, cfg: cfg}
+// WithClock подменяет источник текущего времени (для тестов).
+func WithClock(now func() time.Time) Option {
+    return func(s *service) { s.now = now }
+}
+
+func NewService(repo repository.Repository, cfg *config.Config, opts ...Option) Service {
+    keys := cfg.JWTKeys
+    if keys == nil {
+        keys = jwtkeys.HMAC(cfg.JWTSecret)
+    }
+    s := &service{
+        repo:     repo,
+        cfg:      cfg,
+        catalog:  newCatalog(repo, cfg.CatalogTTL),
+        keys:     keys,
+        attempts: repository.NewMemoryLoginAttemptStore(),
+        now:      time.Now,
+    }
+    if cfg.OIDCIssuer != "" {
+        s.oidc = oidc.New(oidc.Config{
+            Issuer:       cfg.OIDCIssuer,
+            ClientID:     cfg.OIDCClientID,
+            ClientSecret: cfg.OIDCClientSecret,
+            RedirectURL:  cfg.OIDCRedirectURL,
+            Scopes:       cfg.OIDCScopes,
+        }, nil)
+    }
+    for _, opt := range opts {
+        opt(s)
+    }
+    return s
 }
 
 // ----------------------------------------
 // AuthUser
 // ----------------------------------------
-func (s *service) AuthUser(username, password string) (string, error) {
+// AuthUser проверяет логин и пароль и открывает сессию. Неизвестный логин
+// в режиме RegistrationAuto регистрирует новый аккаунт, в
+// RegistrationExplicit — ErrUserNotFound. Неудачные попытки считаются по
+// имени и по clientIP; при превышении лимита — *LoginThrottledError.
+// Если у пользователя включена 2FA, вместо токенов возвращается mfaToken.
+func (s *service) AuthUser(username, password, clientIP string) (*models.AuthResponse, error) {
     username = strings.TrimSpace(username)
     if username == "" || password == "" {
-        return "", errors.New("invalid password")
+        return nil, ErrInvalidPassword
+    }
+    // Попытка учитывается до проверки пароля; неудачи ниже уже посчитаны.
+    attempt, err := s.beginLoginAttempt(username, clientIP)
+    if err != nil {
+        return nil, err
     }
 
     user, err := s.repo.GetUserByUsername(username)
     if err != nil {
-        return "", err
+        return nil, err
     }
 
     if user == nil {
-        hashedPass, errHash := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-        if errHash != nil {
-            return "", errHash
+        if s.cfg.RegistrationMode == config.RegistrationExplicit {
+            return nil, ErrUserNotFound
+        }
+        newUserID, err := s.createAccount(username, password)
+        if err != nil {
+            return nil, err
         }
-        newUserID, errCreate := s.repo.CreateUser(username, string(hashedPass))
-        if errCreate != nil {
-            return "", errCreate
+        if err := s.loginSucceeded(attempt); err != nil {
+            return nil, err
         }
-        token, errToken := GenerateJWT(newUserID, s.cfg.JWTSecret)
-        return token, errToken
+        return s.issueTokens(newUserID, username, models.RoleEmployee)
     }
 
     if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-        return "", errors.New("invalid password")
+        return nil, ErrInvalidPassword
     }
-
-    token, err := GenerateJWT(user.ID, s.cfg.JWTSecret)
-    return token, err
+    challenge, err := s.mfaChallenge(user)
+    if err != nil {
+        return nil, err
+    }
+    if challenge != nil {
+        // Счётчик по имени обнулит только VerifyMFA после верного кода.
+        if err := s.secondFactorRequired(attempt); err != nil {
+            return nil, err
+        }
+        return challenge, nil
+    }
+    if err := s.loginSucceeded(attempt); err != nil {
+        return nil, err
+    }
+    return s.issueTokens(user.ID, user.Username, user.Role)
 }
 
 // ----------------------------------------
@@ -98,19 +219,10 @@ func (s *service) GetInfo(userID int) (*models.InfoResponse, error) {
         return nil, errors.New("user not found")
     }
 
-    purchases, err := s.repo.GetAllPurchasesByUserID(user.ID)
+    inventory, err := s.inventory(user.ID)
     if err != nil {
         return nil, err
     }
-    inventoryMap := make(map[string]int)
-    for _, p := range purchases {
-        inventoryMap[p.ItemName] += p.Quantity
-    }
-
-    var inventory []models.InvItem
-    for k, v := range inventoryMap {
-        inventory = append(inventory, models.InvItem{Type: k, Quantity: v})
-    }
 
     transactions, err := s.repo.GetCoinTransactionsByUserID(user.ID)
     if err != nil {
@@ -121,29 +233,26 @@ func (s *service) GetInfo(userID int) (*models.InfoResponse, error) {
     sent := make([]models.SentCoin, 0)
 
     for _, t := range transactions {
+        // Стартовый баланс до журнала в истории не показывался; клиенты
+        // /api/info по-прежнему видят только реальные поступления.
+        if t.Kind == models.TxGrant {
+            continue
+        }
         if t.ToUserID != nil && *t.ToUserID == user.ID {
-            fromName := "store"
-            if t.FromUserID != nil {
-                fromUser, _ := s.repo.GetUserByID(*t.FromUserID)
-                if fromUser != nil {
-                    fromName = fromUser.Username
-                }
-            }
             received = append(received, models.ReceivedCoin{
-                FromUser: fromName,
+                FromUser: participantName(t.FromUsername, t.Kind),
                 Amount:   t.Amount,
+                Kind:     t.Kind,
+                OrderID:  t.OrderID,
+                Memo:     t.Memo,
             })
         } else if t.FromUserID != nil && *t.FromUserID == user.ID {
-            toName := "store"
-            if t.ToUserID != nil {
-                toUser, _ := s.repo.GetUserByID(*t.ToUserID)
-                if toUser != nil {
-                    toName = toUser.Username
-                }
-            }
             sent = append(sent, models.SentCoin{
-                ToUser: toName,
-                Amount: t.Amount,
+                ToUser:  participantName(t.ToUsername, t.Kind),
+                Amount:  t.Amount,
+                Kind:    t.Kind,
+                OrderID: t.OrderID,
+                Memo:    t.Memo,
             })
         }
     }
@@ -158,66 +267,138 @@ func (s *service) GetInfo(userID int) (*models.InfoResponse, error) {
     }, nil
 }
 
+// inventory сворачивает покупки пользователя в количества по товарам,
+// добавляет данные из каталога и сортирует по имени товара.
+func (s *service) inventory(userID int) ([]models.InvItem, error) {
+    purchases, err := s.repo.GetAllPurchasesByUserID(userID)
+    if err != nil {
+        return nil, err
+    }
+    inventoryMap := make(map[string]*models.InvItem)
+    for _, p := range purchases {
+        inv, ok := inventoryMap[p.ItemName]
+        if !ok {
+            inv = &models.InvItem{Type: p.ItemName, FirstPurchasedAt: p.CreatedAt, LastPurchasedAt: p.CreatedAt}
+            inventoryMap[p.ItemName] = inv
+        }
+        inv.Quantity += p.Quantity
+        if p.CreatedAt.Before(inv.FirstPurchasedAt) {
+            inv.FirstPurchasedAt = p.CreatedAt
+        }
+        if p.CreatedAt.After(inv.LastPurchasedAt) {
+            inv.LastPurchasedAt = p.CreatedAt
+        }
+    }
+
+    // Активные товары берём из кэша каталога, снятые с продажи — одним
+    // запросом к items.
+    var retired []string
+    for _, inv := range inventoryMap {
+        item, ok, err := s.catalog.Lookup(inv.Type)
+        if err != nil {
+            return nil, err
+        }
+        if !ok {
+            retired = append(retired, inv.Type)
+            continue
+        }
+        inv.Title = item.Title
+        inv.UnitPrice = item.Price
+    }
+    if len(retired) > 0 {
+        items, err := s.repo.GetItemsByNames(retired)
+        if err != nil {
+            return nil, err
+        }
+        for _, item := range items {
+            inv := inventoryMap[item.Name]
+            inv.Title = item.Title
+            inv.UnitPrice = item.Price
+        }
+    }
+
+    inventory := make([]models.InvItem, 0, len(inventoryMap))
+    for _, inv := range inventoryMap {
+        inventory = append(inventory, *inv)
+    }
+    sort.Slice(inventory, func(i, j int) bool {
+        return inventory[i].Type < inventory[j].Type
+    })
+    return inventory, nil
+}
+
 
 // ----------------------------------------
 // SendCoin
 // ----------------------------------------
 
-func (s *service) SendCoin(fromUserID int, toUsername string, amount int) error {
-    // LOG: выводим параметры
-    fmt.Printf("SendCoin: fromUserID=%d, toUser=%s, amount=%d\n", fromUserID, toUsername, amount)
-
+func (s *service) SendCoin(fromUserID int, toUsername string, amount int, memo string) error {
     if amount <= 0 {
-        return errors.New("amount must be positive")
+        return ErrNegativeAmount
     }
     toUsername = strings.TrimSpace(toUsername)
     if toUsername == "" {
-        return errors.New("empty toUser")
+        return ErrEmptyRecipient
     }
-
-    fromUser, err := s.repo.GetUserByID(fromUserID)
-    if err != nil {
-        return err
-    }
-    if fromUser == nil {
-        return errors.New("user not found")
+    memo = strings.TrimSpace(memo)
+    if len([]rune(memo)) > maxMemoLength {
+        return ErrMemoTooLong
     }
 
-    fmt.Printf("SendCoin: fromUser before => ID=%d, coins=%d\n", fromUser.ID, fromUser.Coins)
-
-    toUser, err := s.repo.GetUserByUsername(toUsername)
-    if err != nil {
-        return err
-    }
-    if toUser == nil {
-        return errors.New("recipient not found")
-    }
-
-    fmt.Printf("SendCoin: toUser before => ID=%d, coins=%d\n", toUser.ID, toUser.Coins)
-
-    if fromUser.Coins < amount {
-        return errors.New("not enough coins")
-    }
+    return s.repo.WithTx(func(repo repository.Repository) error {
+        toUser, err := repo.GetUserByUsername(toUsername)
+        if err != nil {
+            return err
+        }
+        if toUser == nil {
+            return ErrRecipientNotFound
+        }
 
-    fromUser.Coins -= amount
-    toUser.Coins += amount
+        // Блокируем строки всегда в порядке возрастания id, чтобы встречные
+        // переводы A->B и B->A не приводили к взаимной блокировке.
+        firstID, secondID := fromUserID, toUser.ID
+        if firstID > secondID {
+            firstID, secondID = secondID, firstID
+        }
 
-    fmt.Printf("SendCoin: fromUser after => ID=%d, coins=%d\n", fromUser.ID, fromUser.Coins)
-    fmt.Printf("SendCoin: toUser after => ID=%d, coins=%d\n", toUser.ID, toUser.Coins)
+        locked := make(map[int]*models.User, 2)
+        for _, id := range []int{firstID, secondID} {
+            if _, ok := locked[id]; ok {
+                continue
+            }
+            u, err := repo.GetUserByIDForUpdate(id)
+            if err != nil {
+                return err
+            }
+            if u == nil {
+                return ErrUserNotFound
+            }
+            locked[id] = u
+        }
 
-    if err := s.repo.UpdateUserCoins(fromUser.ID, fromUser.Coins); err != nil {
-        return err
-    }
-    if err := s.repo.UpdateUserCoins(toUser.ID, toUser.Coins); err != nil {
-        return err
-    }
+        fromUser := locked[fromUserID]
+        if fromUser.Coins < amount {
+            return ErrNotEnoughCoins
+        }
 
-    err = s.repo.InsertCoinTransaction(&fromUserID, &toUser.ID, amount)
-    if err != nil {
-        return err
-    }
+        if err := repo.AddUserCoins(fromUserID, -amount); err != nil {
+            if err == repository.ErrBalanceTooLow {
+                return ErrNotEnoughCoins
+            }
+            return err
+        }
+        if err := repo.AddUserCoins(toUser.ID, amount); err != nil {
+            return err
+        }
 
-    return nil
+        return repo.InsertCoinTransaction(models.CoinTransaction{
+            FromUserID: &fromUserID,
+            ToUserID:   &toUser.ID,
+            Amount:     amount,
+            Kind:       models.TxTransfer,
+            Memo:       memo,
+        })
+    })
 }
 
 
@@ -225,47 +406,89 @@ func (s *service) SendCoin(fromUserID int, toUsername string, amount int) error
 // BuyItem
 // ----------------------------------------
 
-func (s *service) BuyItem(userID int, itemName string) error {
+func (s *service) BuyItem(userID int, itemName string, quantity int) error {
+    if quantity <= 0 {
+        return ErrInvalidQuantity
+    }
     itemName = strings.TrimSpace(itemName)
-    price, ok := itemPrices[itemName]
-    if !ok {
-        return errors.New("invalid item")
+    // Кэш каталога отсекает неизвестные товары без транзакции; цену и
+    // активность берём из строки items под блокировкой.
+    if _, ok, err := s.catalog.Lookup(itemName); err != nil {
+        return err
+    } else if !ok {
+        return ErrInvalidItem
     }
 
-    fmt.Printf("BuyItem: userID=%d, itemName=%s, price=%d\n", userID, itemName, price)
+    return s.repo.WithTx(func(repo repository.Repository) error {
+        user, err := repo.GetUserByID(userID)
+        if err != nil {
+            return err
+        }
+        if user == nil {
+            return ErrUserNotFound
+        }
 
-    user, err := s.repo.GetUserByID(userID)
-    if err != nil {
-        return err
-    }
-    if user == nil {
-        return errors.New("user not found")
-    }
+        item, err := lockItem(repo, itemName)
+        if err != nil {
+            return err
+        }
+        // users.coins — INT, итоговая сумма должна в него помещаться
+        if quantity > math.MaxInt32/item.Price {
+            return ErrQuantityTooLarge
+        }
+        price := item.Price * quantity
 
-    fmt.Printf("BuyItem: user before => ID=%d, coins=%d\n", user.ID, user.Coins)
+        if err := repo.DecrementItemStock(item.ID, quantity); err != nil {
+            if err == repository.ErrStockTooLow {
+                return ErrOutOfStock
+            }
+            return err
+        }
 
-    if user.Coins < price {
-        return errors.New("not enough coins")
-    }
+        // Условное списание: проверка баланса и уменьшение — один UPDATE,
+        // поэтому параллельные покупки не могут уйти в минус.
+        if err := repo.DebitUserCoins(user.ID, price); err != nil {
+            if err == repository.ErrBalanceTooLow {
+                return ErrNotEnoughCoins
+            }
+            return err
+        }
 
-    newCoins := user.Coins - price
+        // Каждая покупка оформляется заказом из одной позиции, чтобы у неё
+        // был статус выдачи, как у заказов из корзины.
+        orderID, err := repo.CreateOrder(user.ID, price)
+        if err != nil {
+            return err
+        }
+        if err := repo.InsertOrderLine(orderID, user.ID, itemName, quantity); err != nil {
+            return err
+        }
 
-    fmt.Printf("BuyItem: user after => ID=%d, coins=%d\n", user.ID, newCoins)
+        return repo.InsertCoinTransaction(purchaseTx(user.ID, orderID, price))
+    })
+}
 
-    if err := s.repo.UpdateUserCoins(user.ID, newCoins); err != nil {
-        return err
-    }
 
-    if err := s.repo.InsertItemPurchase(user.ID, itemName, 1); err != nil {
-        return err
-    }
+// ----------------------------------------
+// ListItems
+// ----------------------------------------
 
-    err = s.repo.InsertCoinTransaction(&userID, nil, price)
+func (s *service) ListItems() ([]models.CatalogItem, error) {
+    items, err := s.catalog.List()
     if err != nil {
-        return err
+        return nil, err
     }
-
-    return nil
+    result := make([]models.CatalogItem, 0, len(items))
+    for _, it := range items {
+        result = append(result, models.CatalogItem{
+            Name:        it.Name,
+            Title:       it.Title,
+            Description: it.Description,
+            Price:       it.Price,
+            Stock:       it.Stock,
+        })
+    }
+    return result, nil
 }
 
 
@@ -273,12 +496,28 @@ func (s *service) BuyItem(userID int, itemName string) error {
 // GenerateJWT
 // ----------------------------------------
 
-func GenerateJWT(userID int, secret string) (string, error) {
-    expirationTime := time.Now().Add(24 * time.Hour)
+// GenerateJWT выпускает access-токен сессии c.SessionID, подписанный
+// текущим ключом keys. tv — token_version пользователя на момент выпуска:
+// после «выйти везде» токен перестаёт проходить JwtMiddleware. Без
+// c.TokenID jti генерируется.
+func GenerateJWT(keys *jwtkeys.KeySet, c models.AccessClaims, ttl time.Duration) (string, error) {
+    expirationTime := time.Now().Add(ttl)
+    jti := c.TokenID
+    if jti == "" {
+        var err error
+        if jti, err = newTokenID(); err != nil {
+            return "", err
+        }
+    }
     claims := jwt.MapClaims{
-        "user_id": userID,
-        "exp":     expirationTime.Unix(),
+        "user_id":  c.UserID,
+        "username": c.Username,
+        "role":     c.Role,
+        "scope":    strings.Join(c.Scopes, " "),
+        "sid":      c.SessionID,
+        "tv":       c.TokenVersion,
+        "jti":      jti,
+        "exp":      expirationTime.Unix(),
     }
-    token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-    return token.SignedString([]byte(secret))
-}
\ No newline at end of file
+    return keys.Sign(claims)
+}
@@ -2,18 +2,43 @@ package service_test
 
 import (
 	"database/sql"
+	"encoding/json"
+	"math"
 	"regexp"
+	"strings"
 	"testing"
+	"time"
 	"golang.org/x/crypto/bcrypt"
 	"avito-shop/internal/config"
+	"avito-shop/internal/models"
 	"avito-shop/internal/repository"
 	"avito-shop/internal/service"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// expectCatalog ожидает загрузку каталога товаров (один раз на сервис).
+func expectCatalog(mock sqlmock.Sqlmock) {
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, name, title, description, price, stock, active, created_at, updated_at
+			  FROM items WHERE active = TRUE`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "title", "description", "price", "stock", "active", "created_at", "updated_at"}).
+			AddRow(1, "cup", "Кружка", "", 20, nil, true, now, now).
+			AddRow(2, "t-shirt", "Футболка", "", 80, 5, true, now, now))
+}
+
+// expectLockedItem ожидает чтение товара под блокировкой внутри покупки.
+func expectLockedItem(mock sqlmock.Sqlmock, id int, name string, price int, active bool) {
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM items WHERE name = $1 FOR UPDATE`)).
+		WithArgs(name).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "title", "description", "price", "stock", "active", "created_at", "updated_at"}).
+			AddRow(id, name, name, "", price, nil, active, now, now))
+}
+
 // -----------------------------------------------------------------------------
 // Тесты AuthUser
 // -----------------------------------------------------------------------------
@@ -31,11 +56,13 @@ func TestAuthUser_NewUser(t *testing.T) {
 	password := "secret123"
 
 	mock.ExpectQuery(regexp.QuoteMeta(
-		`SELECT id, username, password, coins FROM users WHERE username = $1`,
+		`SELECT id, username, password, coins, role FROM users WHERE username = $1`,
 	)).
 		WithArgs(username).
 		WillReturnError(sql.ErrNoRows)
 
+	mock.ExpectBegin()
+
 	mock.
 		ExpectQuery(regexp.QuoteMeta(
 			`INSERT INTO users (username, password, coins) VALUES ($1, $2, 1000) RETURNING id`,
@@ -43,9 +70,23 @@ func TestAuthUser_NewUser(t *testing.T) {
 		WithArgs(username, sqlmock.AnyArg()). 
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(100))
 
-	token, err := svc.AuthUser(username, password)
+	// Стартовый баланс журналируется как grant от treasury
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO coin_transactions (from_user_id, to_user_id, amount, kind, order_id, memo)`)).
+		WithArgs(nil, 100, 1000, "grant", nil, "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO ledger_postings (transaction_id, user_id, system_account, amount)`)).
+		WithArgs(1, nil, "treasury", -1000, 100, nil, 1000).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	mock.ExpectCommit()
+
+	expectSession(mock, 100, 7)
+
+	token, err := svc.AuthUser(username, password, "")
 	require.NoError(t, err)
-	assert.NotEmpty(t, token, "JWT token should be returned")
+	assert.NotEmpty(t, token.Token, "JWT token should be returned")
+	assert.NotEmpty(t, token.RefreshToken)
 
 	require.NoError(t, mock.ExpectationsWereMet())
 }
@@ -66,15 +107,18 @@ func TestAuthUser_ExistingUser_OK(t *testing.T) {
     realHash, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
 
     mock.ExpectQuery(regexp.QuoteMeta(
-        `SELECT id, username, password, coins FROM users WHERE username = $1`,
+        `SELECT id, username, password, coins, role FROM users WHERE username = $1`,
     )).
         WithArgs(username).
-        WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins"}).
-            AddRow(1, "alice", string(realHash), 1000))
+        WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}).
+            AddRow(1, "alice", string(realHash), 1000, "employee"))
 
-    token, err := svc.AuthUser(username, password)
+    expectNoTOTP(mock, 1)
+    expectSession(mock, 1, 3)
+
+    token, err := svc.AuthUser(username, password, "")
     require.NoError(t, err, "AuthUser should succeed with correct password")
-    assert.NotEmpty(t, token)
+    assert.NotEmpty(t, token.Token)
 
     require.NoError(t, mock.ExpectationsWereMet())
 }
@@ -95,16 +139,16 @@ func TestAuthUser_ExistingUser_BadPassword(t *testing.T) {
 	hashedPass := "$2a$10$IXpQW...someHashOfRealPassword...vZ8S9Eu"
 
 	mock.ExpectQuery(regexp.QuoteMeta(
-		`SELECT id, username, password, coins FROM users WHERE username = $1`,
+		`SELECT id, username, password, coins, role FROM users WHERE username = $1`,
 	)).
 		WithArgs(username).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins"}).
-			AddRow(1, "alice", hashedPass, 1000))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}).
+			AddRow(1, "alice", hashedPass, 1000, "employee"))
 
-	token, err := svc.AuthUser(username, password)
+	token, err := svc.AuthUser(username, password, "")
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "invalid password")
-	assert.Empty(t, token)
+	assert.Nil(t, token)
 
 	require.NoError(t, mock.ExpectationsWereMet())
 }
@@ -119,10 +163,10 @@ func TestAuthUser_EmptyCredentials(t *testing.T) {
 	cfg := &config.Config{}
 	svc := service.NewService(repo, cfg)
 
-	token, err := svc.AuthUser("", "")
+	token, err := svc.AuthUser("", "", "")
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "invalid password")
-	assert.Empty(t, token)
+	assert.Nil(t, token)
 }
 
 // -----------------------------------------------------------------------------
@@ -142,29 +186,91 @@ func TestSendCoin_Success(t *testing.T) {
 	toUsername := "bob"
 	amount := 100
 
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins FROM users WHERE id = $1`)).
-		WithArgs(fromUserID).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins"}).
-			AddRow(1, "alice", "somepass", 500))
+	mock.ExpectBegin()
 
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins FROM users WHERE username = $1`)).
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins, role FROM users WHERE username = $1`)).
 		WithArgs(toUsername).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins"}).
-			AddRow(2, "bob", "passbob", 200))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}).
+			AddRow(2, "bob", "passbob", 200, "employee"))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins, role FROM users WHERE id = $1 FOR UPDATE`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}).
+			AddRow(1, "alice", "somepass", 500, "employee"))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins, role FROM users WHERE id = $1 FOR UPDATE`)).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}).
+			AddRow(2, "bob", "passbob", 200, "employee"))
+
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET coins = coins + $1 WHERE id = $2`)).
+		WithArgs(-100, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
 
-	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET coins = $1 WHERE id = $2`)).
-		WithArgs(400, 1).
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET coins = coins + $1 WHERE id = $2`)).
+		WithArgs(100, 2).
 		WillReturnResult(sqlmock.NewResult(0, 1))
 
-	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET coins = $1 WHERE id = $2`)).
-		WithArgs(300, 2).
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO coin_transactions (from_user_id, to_user_id, amount, kind, order_id, memo)`)).
+		WithArgs(1, 2, 100, "transfer", nil, "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(42))
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO ledger_postings (transaction_id, user_id, system_account, amount)`)).
+		WithArgs(42, 1, nil, -100, 2, nil, 100).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	mock.ExpectCommit()
+
+	err = svc.SendCoin(fromUserID, toUsername, amount, "")
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSendCoin_LocksInIDOrder(t *testing.T) {
+	// Отправитель с большим id: строки всё равно блокируются по возрастанию id
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := repository.NewRepository(db)
+	cfg := &config.Config{}
+	svc := service.NewService(repo, cfg)
+
+	mock.ExpectBegin()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins, role FROM users WHERE username = $1`)).
+		WithArgs("alice").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}).
+			AddRow(1, "alice", "somepass", 500, "employee"))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins, role FROM users WHERE id = $1 FOR UPDATE`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}).
+			AddRow(1, "alice", "somepass", 500, "employee"))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins, role FROM users WHERE id = $1 FOR UPDATE`)).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}).
+			AddRow(2, "bob", "passbob", 200, "employee"))
+
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET coins = coins + $1 WHERE id = $2`)).
+		WithArgs(-50, 2).
 		WillReturnResult(sqlmock.NewResult(0, 1))
 
-	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO coin_transactions (from_user_id, to_user_id, amount) VALUES ($1, $2, $3)`)).
-		WithArgs(1, 2, 100).
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET coins = coins + $1 WHERE id = $2`)).
+		WithArgs(50, 1).
 		WillReturnResult(sqlmock.NewResult(0, 1))
 
-	err = svc.SendCoin(fromUserID, toUsername, amount)
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO coin_transactions (from_user_id, to_user_id, amount, kind, order_id, memo)`)).
+		WithArgs(2, 1, 50, "transfer", nil, "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(42))
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO ledger_postings (transaction_id, user_id, system_account, amount)`)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	mock.ExpectCommit()
+
+	err = svc.SendCoin(2, "alice", 50, "")
 	require.NoError(t, err)
 	require.NoError(t, mock.ExpectationsWereMet())
 }
@@ -182,22 +288,32 @@ func TestSendCoin_NotEnoughCoins(t *testing.T) {
     toUsername := "bob"
     amount := 1000
 
+    mock.ExpectBegin()
+
     mock.ExpectQuery(regexp.QuoteMeta(
-        `SELECT id, username, password, coins FROM users WHERE id = $1`,
+        `SELECT id, username, password, coins, role FROM users WHERE username = $1`,
+    )).
+        WithArgs(toUsername).
+        WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}).
+            AddRow(2, "bob", "passbob", 500, "employee"))
+
+    mock.ExpectQuery(regexp.QuoteMeta(
+        `SELECT id, username, password, coins, role FROM users WHERE id = $1 FOR UPDATE`,
     )).
         WithArgs(fromUserID).
-        WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins"}).
-            AddRow(1, "alice", "somepass", 200))
+        WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}).
+            AddRow(1, "alice", "somepass", 200, "employee"))
 
     mock.ExpectQuery(regexp.QuoteMeta(
-        `SELECT id, username, password, coins FROM users WHERE username = $1`,
+        `SELECT id, username, password, coins, role FROM users WHERE id = $1 FOR UPDATE`,
     )).
-        WithArgs(toUsername).
-        WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins"}).
-            AddRow(2, "bob", "passbob", 500))
+        WithArgs(2).
+        WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}).
+            AddRow(2, "bob", "passbob", 500, "employee"))
 
+    mock.ExpectRollback()
 
-    err = svc.SendCoin(fromUserID, toUsername, amount)
+    err = svc.SendCoin(fromUserID, toUsername, amount, "")
     assert.EqualError(t, err, "not enough coins")
 
     require.NoError(t, mock.ExpectationsWereMet())
@@ -216,23 +332,62 @@ func TestSendCoin_ReceiverNotFound(t *testing.T) {
 	toUsername := "unknown"
 	amount := 50
 
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins FROM users WHERE id = $1`)).
-		WithArgs(fromUserID).
-		WillReturnRows(
-			sqlmock.NewRows([]string{"id", "username", "password", "coins"}).
-				AddRow(1, "alice", "somepass", 500),
-		)
+	mock.ExpectBegin()
 
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins FROM users WHERE username = $1`)).
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins, role FROM users WHERE username = $1`)).
 		WithArgs(toUsername).
 		WillReturnError(sql.ErrNoRows)
 
-	err = svc.SendCoin(fromUserID, toUsername, amount)
+	mock.ExpectRollback()
+
+	err = svc.SendCoin(fromUserID, toUsername, amount, "")
 	assert.EqualError(t, err, "recipient not found")
 
 	require.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestSendCoin_RollbackOnFailure(t *testing.T) {
+	// Ошибка на середине перевода => транзакция откатывается, ledger не пишется
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := repository.NewRepository(db)
+	cfg := &config.Config{}
+	svc := service.NewService(repo, cfg)
+
+	mock.ExpectBegin()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins, role FROM users WHERE username = $1`)).
+		WithArgs("bob").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}).
+			AddRow(2, "bob", "passbob", 200, "employee"))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins, role FROM users WHERE id = $1 FOR UPDATE`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}).
+			AddRow(1, "alice", "somepass", 500, "employee"))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins, role FROM users WHERE id = $1 FOR UPDATE`)).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}).
+			AddRow(2, "bob", "passbob", 200, "employee"))
+
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET coins = coins + $1 WHERE id = $2`)).
+		WithArgs(-100, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET coins = coins + $1 WHERE id = $2`)).
+		WithArgs(100, 2).
+		WillReturnError(sql.ErrConnDone)
+
+	mock.ExpectRollback()
+
+	err = svc.SendCoin(1, "bob", 100, "")
+	require.ErrorIs(t, err, sql.ErrConnDone)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
 // -----------------------------------------------------------------------------
 // Тесты BuyItem
 // -----------------------------------------------------------------------------
@@ -249,26 +404,46 @@ func TestBuyItem_Success(t *testing.T) {
 	userID := 10
 	itemName := "t-shirt" // 80 монет
 
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins FROM users WHERE id = $1`)).
+	expectCatalog(mock)
+
+	mock.ExpectBegin()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins, role FROM users WHERE id = $1`)).
 		WithArgs(userID).
 		WillReturnRows(
-			sqlmock.NewRows([]string{"id", "username", "password", "coins"}).
-				AddRow(10, "alice", "somepass", 200),
+			sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}).
+				AddRow(10, "alice", "somepass", 200, "employee"),
 		)
 
-	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET coins = $1 WHERE id = $2`)).
-		WithArgs(120, 10).
+	expectLockedItem(mock, 2, "t-shirt", 80, true)
+
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE items SET stock = stock - $1`)).
+		WithArgs(1, 2).
 		WillReturnResult(sqlmock.NewResult(0, 1))
 
-	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO item_purchases (user_id, item_name, quantity) VALUES ($1, $2, $3)`)).
-		WithArgs(10, "t-shirt", 1).
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET coins = coins - $1 WHERE id = $2 AND coins >= $1`)).
+		WithArgs(80, 10).
 		WillReturnResult(sqlmock.NewResult(0, 1))
 
-	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO coin_transactions (from_user_id, to_user_id, amount) VALUES ($1, $2, $3)`)).
-		WithArgs(10, nil, 80).
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO orders (user_id, total) VALUES ($1, $2) RETURNING id`)).
+		WithArgs(10, 80).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO item_purchases (user_id, item_name, quantity, order_id) VALUES ($1, $2, $3, $4)`)).
+		WithArgs(10, "t-shirt", 1, 5).
 		WillReturnResult(sqlmock.NewResult(0, 1))
 
-	err = svc.BuyItem(userID, itemName)
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO coin_transactions (from_user_id, to_user_id, amount, kind, order_id, memo)`)).
+		WithArgs(10, nil, 80, "purchase", 5, "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(42))
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO ledger_postings (transaction_id, user_id, system_account, amount)`)).
+		WithArgs(42, 10, nil, -80, nil, "store", 80).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	mock.ExpectCommit()
+
+	err = svc.BuyItem(userID, itemName, 1)
 	assert.NoError(t, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
@@ -285,21 +460,193 @@ func TestBuyItem_NotEnoughCoins(t *testing.T) {
 	userID := 10
 	itemName := "t-shirt" 
 
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins FROM users WHERE id = $1`)).
+	expectCatalog(mock)
+
+	mock.ExpectBegin()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins, role FROM users WHERE id = $1`)).
 		WithArgs(userID).
 		WillReturnRows(
-			sqlmock.NewRows([]string{"id", "username", "password", "coins"}).
-				AddRow(10, "alice", "somepass", 50),
+			sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}).
+				AddRow(10, "alice", "somepass", 50, "employee"),
 		)
 
-	err = svc.BuyItem(userID, itemName)
+	expectLockedItem(mock, 2, "t-shirt", 80, true)
+
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE items SET stock = stock - $1`)).
+		WithArgs(1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	// Условный UPDATE не затронул ни одной строки
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET coins = coins - $1 WHERE id = $2 AND coins >= $1`)).
+		WithArgs(80, 10).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	mock.ExpectRollback()
+
+	err = svc.BuyItem(userID, itemName, 1)
 	assert.EqualError(t, err, "not enough coins")
 
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestBuyItem_CheckConstraintViolation(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := repository.NewRepository(db)
+	cfg := &config.Config{}
+	svc := service.NewService(repo, cfg)
+
+	expectCatalog(mock)
+
+	mock.ExpectBegin()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins, role FROM users WHERE id = $1`)).
+		WithArgs(10).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}).
+				AddRow(10, "alice", "somepass", 100, "employee"),
+		)
+
+	expectLockedItem(mock, 2, "t-shirt", 80, true)
+
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE items SET stock = stock - $1`)).
+		WithArgs(1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET coins = coins - $1 WHERE id = $2 AND coins >= $1`)).
+		WithArgs(80, 10).
+		WillReturnError(&pq.Error{Code: "23514", Constraint: "users_coins_non_negative"})
+
+	mock.ExpectRollback()
+
+	err = svc.BuyItem(10, "t-shirt", 1)
+	assert.ErrorIs(t, err, service.ErrNotEnoughCoins)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBuyItem_OutOfStock(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := repository.NewRepository(db)
+	cfg := &config.Config{}
+	svc := service.NewService(repo, cfg)
+
+	expectCatalog(mock)
+
+	mock.ExpectBegin()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins, role FROM users WHERE id = $1`)).
+		WithArgs(10).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}).
+				AddRow(10, "alice", "somepass", 1000, "employee"),
+		)
+
+	expectLockedItem(mock, 2, "t-shirt", 80, true)
+
+	// Остаток закончился: условный UPDATE по items не затронул строк
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE items SET stock = stock - $1`)).
+		WithArgs(1, 2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	mock.ExpectRollback()
+
+	err = svc.BuyItem(10, "t-shirt", 1)
+	assert.ErrorIs(t, err, service.ErrOutOfStock)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBuyItem_MultipleUnits(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := repository.NewRepository(db)
+	cfg := &config.Config{}
+	svc := service.NewService(repo, cfg)
+
+	expectCatalog(mock)
+
+	mock.ExpectBegin()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins, role FROM users WHERE id = $1`)).
+		WithArgs(10).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}).
+				AddRow(10, "alice", "somepass", 1000, "employee"),
+		)
+
+	expectLockedItem(mock, 1, "cup", 20, true)
+
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE items SET stock = stock - $1`)).
+		WithArgs(3, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET coins = coins - $1 WHERE id = $2 AND coins >= $1`)).
+		WithArgs(60, 10).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO orders (user_id, total) VALUES ($1, $2) RETURNING id`)).
+		WithArgs(10, 60).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO item_purchases (user_id, item_name, quantity, order_id) VALUES ($1, $2, $3, $4)`)).
+		WithArgs(10, "cup", 3, 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO coin_transactions (from_user_id, to_user_id, amount, kind, order_id, memo)`)).
+		WithArgs(10, nil, 60, "purchase", 5, "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(42))
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO ledger_postings (transaction_id, user_id, system_account, amount)`)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	mock.ExpectCommit()
+
+	err = svc.BuyItem(10, "cup", 3)
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBuyItem_InvalidQuantity(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := repository.NewRepository(db)
+	cfg := &config.Config{}
+	svc := service.NewService(repo, cfg)
+
+	err = svc.BuyItem(10, "cup", 0)
+	assert.ErrorIs(t, err, service.ErrInvalidQuantity)
+
+	err = svc.BuyItem(10, "cup", -5)
+	assert.ErrorIs(t, err, service.ErrInvalidQuantity)
+
+	// Переполнение: 20 * (MaxInt32/10) не помещается в INT
+	expectCatalog(mock)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins, role FROM users WHERE id = $1`)).
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}).
+			AddRow(10, "alice", "somepass", 1000, "employee"))
+	expectLockedItem(mock, 1, "cup", 20, true)
+	mock.ExpectRollback()
+	err = svc.BuyItem(10, "cup", math.MaxInt32/10)
+	assert.ErrorIs(t, err, service.ErrQuantityTooLarge)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestBuyItem_UnknownItem(t *testing.T) {
-	db, _, err := sqlmock.New()
+	db, mock, err := sqlmock.New()
 	require.NoError(t, err)
 	defer db.Close()
 
@@ -310,8 +657,60 @@ func TestBuyItem_UnknownItem(t *testing.T) {
 	userID := 10
 	itemName := "some-weird-item"
 
-	err = svc.BuyItem(userID, itemName)
+	expectCatalog(mock)
+
+	err = svc.BuyItem(userID, itemName, 1)
 	assert.EqualError(t, err, "invalid item")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBuyItem_PriceFromLockedRow(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+
+	// В кэше каталога кружка стоит 20, но цену подняли до 25 после
+	// загрузки кэша: списывается цена из БД.
+	expectCatalog(mock)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins, role FROM users WHERE id = $1`)).
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}).
+			AddRow(10, "alice", "somepass", 1000, "employee"))
+	expectLockedItem(mock, 1, "cup", 25, true)
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE items SET stock = stock - $1`)).
+		WithArgs(2, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET coins = coins - $1 WHERE id = $2 AND coins >= $1`)).
+		WithArgs(50, 10).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO orders (user_id, total) VALUES ($1, $2) RETURNING id`)).
+		WithArgs(10, 50).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO item_purchases (user_id, item_name, quantity, order_id) VALUES ($1, $2, $3, $4)`)).
+		WithArgs(10, "cup", 2, 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO coin_transactions (from_user_id, to_user_id, amount, kind, order_id, memo)`)).
+		WithArgs(10, nil, 50, "purchase", 5, "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(42))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO ledger_postings (transaction_id, user_id, system_account, amount)`)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+	require.NoError(t, svc.BuyItem(10, "cup", 2))
+
+	// Товар сняли с продажи, а кэш ещё считает его активным.
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins, role FROM users WHERE id = $1`)).
+		WithArgs(10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}).
+			AddRow(10, "alice", "somepass", 1000, "employee"))
+	expectLockedItem(mock, 1, "cup", 25, false)
+	mock.ExpectRollback()
+	assert.ErrorIs(t, svc.BuyItem(10, "cup", 1), service.ErrInvalidItem)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
 
@@ -331,7 +730,7 @@ func TestGetInfo_NoUser(t *testing.T) {
 
 	userID := 999
 
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins FROM users WHERE id = $1`)).
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins, role FROM users WHERE id = $1`)).
 		WithArgs(userID).
 		WillReturnError(sql.ErrNoRows)
 
@@ -341,3 +740,126 @@ func TestGetInfo_NoUser(t *testing.T) {
 
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
+
+func TestGetInfo_HistoryKinds(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := repository.NewRepository(db)
+	cfg := &config.Config{}
+	svc := service.NewService(repo, cfg)
+
+	now := time.Now()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins, role FROM users WHERE id = $1`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}).
+			AddRow(1, "alice", "somepass", 930, "employee"))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM item_purchases p`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "item_name", "quantity", "order_id", "created_at"}))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM coin_transactions`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(historyColumns).
+			AddRow(4, nil, 1, 20, "refund", 7, "", now, nil, "alice").
+			AddRow(3, nil, 1, 1000, "grant", nil, "", now, nil, "alice").
+			AddRow(2, 1, nil, 20, "purchase", 7, "", now, "alice", nil).
+			AddRow(1, 2, 1, 50, "transfer", nil, "за пиццу", now, "bob", "alice"))
+
+	info, err := svc.GetInfo(1)
+	require.NoError(t, err)
+
+	// Стартовый баланс (grant) в истории не показывается.
+	require.Len(t, info.CoinHistory.Received, 2)
+	assert.Equal(t, "store", info.CoinHistory.Received[0].FromUser)
+	assert.Equal(t, "refund", info.CoinHistory.Received[0].Kind)
+	assert.Equal(t, "bob", info.CoinHistory.Received[1].FromUser)
+	assert.Equal(t, "transfer", info.CoinHistory.Received[1].Kind)
+	assert.Equal(t, "за пиццу", info.CoinHistory.Received[1].Memo)
+
+	require.Len(t, info.CoinHistory.Sent, 1)
+	assert.Equal(t, "purchase", info.CoinHistory.Sent[0].Kind)
+	require.NotNil(t, info.CoinHistory.Sent[0].OrderID)
+	assert.Equal(t, 7, *info.CoinHistory.Sent[0].OrderID)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSendCoin_MemoTooLong(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := repository.NewRepository(db)
+	cfg := &config.Config{}
+	svc := service.NewService(repo, cfg)
+
+	err = svc.SendCoin(1, "bob", 10, strings.Repeat("я", 256))
+	assert.ErrorIs(t, err, service.ErrMemoTooLong)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetInfo_Inventory(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+
+	first := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	last := first.Add(48 * time.Hour)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins, role FROM users WHERE id = $1`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}).
+			AddRow(1, "alice", "somepass", 800, "employee"))
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM item_purchases p`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "item_name", "quantity", "order_id", "created_at"}).
+			AddRow(4, 1, "t-shirt", 1, 3, last).
+			AddRow(3, 1, "cup", 2, 2, last).
+			AddRow(2, 1, "pen", 1, 1, first).
+			AddRow(1, 1, "cup", 1, nil, first))
+	expectCatalog(mock)
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM items WHERE name = ANY($1)`)).
+		WithArgs(pq.Array([]string{"pen"})).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "title", "description", "price", "stock", "active", "created_at", "updated_at"}).
+			AddRow(3, "pen", "Ручка", "", 10, nil, false, first, first))
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM coin_transactions`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(historyColumns))
+
+	info, err := svc.GetInfo(1)
+	require.NoError(t, err)
+
+	require.Len(t, info.Inventory, 3)
+	assert.Equal(t, []string{"cup", "pen", "t-shirt"},
+		[]string{info.Inventory[0].Type, info.Inventory[1].Type, info.Inventory[2].Type})
+
+	cup := info.Inventory[0]
+	assert.Equal(t, 3, cup.Quantity)
+	assert.Equal(t, "Кружка", cup.Title)
+	assert.Equal(t, 20, cup.UnitPrice)
+	assert.Equal(t, first, cup.FirstPurchasedAt)
+	assert.Equal(t, last, cup.LastPurchasedAt)
+
+	// Снятый с продажи товар остаётся в инвентаре с названием и ценой из items.
+	assert.Equal(t, "Ручка", info.Inventory[1].Title)
+	assert.Equal(t, 10, info.Inventory[1].UnitPrice)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetInfo_EmptyInventoryIsArray(t *testing.T) {
+	repo := &historyRepo{user: models.User{ID: 1, Username: "alice", Coins: 1000}}
+	svc := service.NewService(repo, &config.Config{})
+
+	info, err := svc.GetInfo(1)
+	require.NoError(t, err)
+
+	body, err := json.Marshal(info)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `"inventory":[]`)
+}
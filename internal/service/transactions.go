@@ -0,0 +1,198 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"avito-shop/internal/models"
+)
+
+var (
+	ErrInvalidDirection        = errors.New("direction must be sent or received")
+	ErrInvalidKind             = errors.New("unknown transaction kind")
+	ErrInvalidCursor           = errors.New("invalid cursor")
+	ErrInvalidDateRange        = errors.New("from must be before to")
+	ErrCounterpartyNotFound    = errors.New("counterparty not found")
+	ErrInvalidTransactionLimit = errors.New("limit must be between 1 and 100")
+)
+
+const (
+	defaultTransactionsLimit = 50
+	maxTransactionsLimit     = 100
+)
+
+var transactionKinds = map[string]bool{
+	models.TxTransfer:   true,
+	models.TxPurchase:   true,
+	models.TxRefund:     true,
+	models.TxGrant:      true,
+	models.TxAdjustment: true,
+	models.TxExpiry:     true,
+}
+
+// ----------------------------------------
+// ListTransactions
+// ----------------------------------------
+
+// ListTransactions возвращает страницу истории пользователя от новых
+// записей к старым. NextCursor пуст, если дальше записей нет.
+func (s *service) ListTransactions(userID int, q models.TransactionQuery) (*models.TransactionsResponse, error) {
+	f := models.TransactionFilter{
+		UserID: userID,
+		Kind:   q.Kind,
+		From:   inUTC(q.From),
+		To:     inUTC(q.To),
+		Limit:  q.Limit,
+	}
+
+	switch q.Direction {
+	case "", "sent", "received":
+		f.Direction = q.Direction
+	default:
+		return nil, ErrInvalidDirection
+	}
+	if f.Kind != "" && !transactionKinds[f.Kind] {
+		return nil, ErrInvalidKind
+	}
+	if f.From != nil && f.To != nil && !f.From.Before(*f.To) {
+		return nil, ErrInvalidDateRange
+	}
+	if f.Limit == 0 {
+		f.Limit = defaultTransactionsLimit
+	}
+	if f.Limit < 0 || f.Limit > maxTransactionsLimit {
+		return nil, ErrInvalidTransactionLimit
+	}
+	if q.Cursor != "" {
+		createdAt, id, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		f.AfterCreatedAt, f.AfterID = &createdAt, id
+	}
+	if name := strings.TrimSpace(q.Counterparty); name != "" {
+		cp, err := s.repo.GetUserByUsername(name)
+		if err != nil {
+			return nil, err
+		}
+		if cp == nil {
+			return nil, ErrCounterpartyNotFound
+		}
+		f.CounterpartyID = &cp.ID
+	}
+
+	// Лишняя запись говорит о том, что есть следующая страница.
+	limit := f.Limit
+	f.Limit++
+	txs, err := s.repo.FindCoinTransactions(f)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &models.TransactionsResponse{Transactions: make([]models.TransactionEntry, 0, len(txs))}
+	if len(txs) > limit {
+		txs = txs[:limit]
+		last := txs[len(txs)-1]
+		resp.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+	for _, t := range txs {
+		resp.Transactions = append(resp.Transactions, transactionEntry(userID, t))
+	}
+	return resp, nil
+}
+
+func transactionEntry(userID int, t models.CoinTransaction) models.TransactionEntry {
+	e := models.TransactionEntry{
+		ID:        t.ID,
+		Amount:    t.Amount,
+		Kind:      t.Kind,
+		OrderID:   t.OrderID,
+		Memo:      t.Memo,
+		CreatedAt: t.CreatedAt,
+	}
+	if t.FromUserID != nil && *t.FromUserID == userID {
+		e.Direction = "sent"
+		e.Counterparty = participantName(t.ToUsername, t.Kind)
+	} else {
+		e.Direction = "received"
+		e.Counterparty = participantName(t.FromUsername, t.Kind)
+	}
+	return e
+}
+
+// inUTC переводит границу периода в UTC: created_at хранится как TIMESTAMP
+// без часового пояса (в UTC), и смещение из RFC3339 иначе потерялось бы.
+func inUTC(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+// Курсор — позиция последней отданной записи (created_at, id) в
+// непрозрачном для клиента виде.
+func encodeCursor(createdAt time.Time, id int) string {
+	raw := fmt.Sprintf("%d:%d", createdAt.UnixNano(), id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (time.Time, int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	var nanos int64
+	var id int
+	if n, err := fmt.Sscanf(string(raw), "%d:%d", &nanos, &id); err != nil || n != 2 || id <= 0 {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	return time.Unix(0, nanos).UTC(), id, nil
+}
+
+// ----------------------------------------
+// GetInfoAggregated
+// ----------------------------------------
+
+// GetInfoAggregated — вариант GetInfo, в котором история свёрнута по
+// второй стороне: сумма и число записей на каждого отправителя/получателя.
+func (s *service) GetInfoAggregated(userID int) (*models.AggregatedInfoResponse, error) {
+	user, err := s.repo.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	inventory, err := s.inventory(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	totals, err := s.repo.GetCoinTotalsByCounterparty(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	history := models.AggregatedCoinHistory{
+		Received: make([]models.ReceivedTotal, 0),
+		Sent:     make([]models.SentTotal, 0),
+	}
+	for _, t := range totals {
+		switch t.Direction {
+		case "received":
+			history.Received = append(history.Received, models.ReceivedTotal{FromUser: t.Counterparty, Amount: t.Amount, Count: t.Count})
+		case "sent":
+			history.Sent = append(history.Sent, models.SentTotal{ToUser: t.Counterparty, Amount: t.Amount, Count: t.Count})
+		}
+	}
+
+	return &models.AggregatedInfoResponse{
+		Coins:       user.Coins,
+		Inventory:   inventory,
+		CoinHistory: history,
+	}, nil
+}
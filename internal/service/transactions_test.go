@@ -0,0 +1,178 @@
+package service_test
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"avito-shop/internal/config"
+	"avito-shop/internal/models"
+	"avito-shop/internal/repository"
+	"avito-shop/internal/service"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var historyColumns = []string{
+	"id", "from_user_id", "to_user_id", "amount", "kind", "order_id", "memo", "created_at",
+	"from_username", "to_username",
+}
+
+func TestListTransactions_Pagination(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+
+	t1 := time.Date(2024, 3, 2, 10, 0, 0, 0, time.UTC)
+	t2 := t1.Add(-time.Hour)
+	t3 := t1.Add(-2 * time.Hour)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`WHERE (t.from_user_id = $1 OR t.to_user_id = $1)`)).
+		WithArgs(1, 3).
+		WillReturnRows(sqlmock.NewRows(historyColumns).
+			AddRow(12, 1, 2, 50, "transfer", nil, "lunch", t1, "alice", "bob").
+			AddRow(11, 2, 1, 30, "transfer", nil, "", t2, "bob", "alice").
+			AddRow(10, nil, 1, 1000, "grant", nil, "", t3, nil, "alice"))
+
+	page, err := svc.ListTransactions(1, models.TransactionQuery{Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, page.Transactions, 2)
+	assert.Equal(t, "sent", page.Transactions[0].Direction)
+	assert.Equal(t, "bob", page.Transactions[0].Counterparty)
+	assert.Equal(t, "lunch", page.Transactions[0].Memo)
+	assert.Equal(t, "received", page.Transactions[1].Direction)
+	assert.Equal(t, "bob", page.Transactions[1].Counterparty)
+	require.NotEmpty(t, page.NextCursor)
+
+	// Вторая страница начинается строго после последней записи первой.
+	mock.ExpectQuery(regexp.QuoteMeta(`AND (t.created_at, t.id) < ($2, $3)`)).
+		WithArgs(1, t2, 11, 3).
+		WillReturnRows(sqlmock.NewRows(historyColumns).
+			AddRow(10, nil, 1, 1000, "grant", nil, "", t3, nil, "alice"))
+
+	page, err = svc.ListTransactions(1, models.TransactionQuery{Limit: 2, Cursor: page.NextCursor})
+	require.NoError(t, err)
+	require.Len(t, page.Transactions, 1)
+	assert.Equal(t, models.AccountTreasury, page.Transactions[0].Counterparty)
+	assert.Empty(t, page.NextCursor)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListTransactions_Filters(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins, role FROM users WHERE username = $1`)).
+		WithArgs("bob").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}).
+			AddRow(2, "bob", "somepass", 1000, "employee"))
+	mock.ExpectQuery(regexp.QuoteMeta(`WHERE t.from_user_id = $1 AND t.to_user_id = $2 AND t.kind = $3 AND t.created_at >= $4 AND t.created_at < $5`)).
+		WithArgs(1, 2, "transfer", from, to, 51).
+		WillReturnRows(sqlmock.NewRows(historyColumns))
+
+	page, err := svc.ListTransactions(1, models.TransactionQuery{
+		Direction:    "sent",
+		Counterparty: "bob",
+		Kind:         "transfer",
+		From:         &from,
+		To:           &to,
+	})
+	require.NoError(t, err)
+	assert.NotNil(t, page.Transactions)
+	assert.Empty(t, page.Transactions)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListTransactions_InvalidQuery(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		q   models.TransactionQuery
+		err error
+	}{
+		{models.TransactionQuery{Direction: "sideways"}, service.ErrInvalidDirection},
+		{models.TransactionQuery{Kind: "gift"}, service.ErrInvalidKind},
+		{models.TransactionQuery{Cursor: "not a cursor"}, service.ErrInvalidCursor},
+		{models.TransactionQuery{From: &from, To: &from}, service.ErrInvalidDateRange},
+		{models.TransactionQuery{Limit: 1000}, service.ErrInvalidTransactionLimit},
+	}
+	for _, c := range cases {
+		_, err := svc.ListTransactions(1, c.q)
+		assert.Equal(t, c.err, err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins, role FROM users WHERE username = $1`)).
+		WithArgs("ghost").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}))
+
+	_, err = svc.ListTransactions(1, models.TransactionQuery{Counterparty: "ghost"})
+	assert.Equal(t, service.ErrCounterpartyNotFound, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListTransactions_PeriodInUTC(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+
+	// 2024-03-01T03:00:00+03:00 — это полночь по UTC.
+	msk := time.FixedZone("MSK", 3*60*60)
+	from := time.Date(2024, 3, 1, 3, 0, 0, 0, msk)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`t.created_at >= $2`)).
+		WithArgs(1, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), 51).
+		WillReturnRows(sqlmock.NewRows(historyColumns))
+
+	_, err = svc.ListTransactions(1, models.TransactionQuery{From: &from})
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetInfoAggregated(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	svc := service.NewService(repository.NewRepository(db), &config.Config{})
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, username, password, coins, role FROM users WHERE id = $1`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "username", "password", "coins", "role"}).
+			AddRow(1, "alice", "somepass", 1250, "employee"))
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM item_purchases p`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "item_name", "quantity", "order_id", "created_at"}))
+	mock.ExpectQuery(regexp.QuoteMeta(`GROUP BY direction, counterparty`)).
+		WithArgs(1, "grant", "adjustment", "expiry", "treasury", "store").
+		WillReturnRows(sqlmock.NewRows([]string{"direction", "counterparty", "sum", "count"}).
+			AddRow("received", "bob", 300, 300).
+			AddRow("sent", "store", 50, 2))
+
+	info, err := svc.GetInfoAggregated(1)
+	require.NoError(t, err)
+	assert.Equal(t, 1250, info.Coins)
+
+	require.Len(t, info.CoinHistory.Received, 1)
+	assert.Equal(t, models.ReceivedTotal{FromUser: "bob", Amount: 300, Count: 300}, info.CoinHistory.Received[0])
+	require.Len(t, info.CoinHistory.Sent, 1)
+	assert.Equal(t, models.SentTotal{ToUser: "store", Amount: 50, Count: 2}, info.CoinHistory.Sent[0])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
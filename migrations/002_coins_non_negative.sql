@@ -0,0 +1,2 @@
+ALTER TABLE users
+    ADD CONSTRAINT users_coins_non_negative CHECK (coins >= 0);
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS items (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) UNIQUE NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    price INT NOT NULL CHECK (price > 0),
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO items (name, title, price) VALUES
+    ('t-shirt',    'Футболка',         80),
+    ('cup',        'Кружка',           20),
+    ('book',       'Книга',            50),
+    ('pen',        'Ручка',            10),
+    ('powerbank',  'Пауэрбанк',       200),
+    ('hoody',      'Худи',            300),
+    ('umbrella',   'Зонт',            200),
+    ('socks',      'Носки',            10),
+    ('wallet',     'Кошелёк',          50),
+    ('pink-hoody', 'Розовое худи',    500)
+ON CONFLICT (name) DO NOTHING;
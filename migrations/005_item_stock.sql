@@ -0,0 +1,3 @@
+-- NULL означает неограниченный запас
+ALTER TABLE items
+    ADD COLUMN IF NOT EXISTS stock INT CHECK (stock IS NULL OR stock >= 0);
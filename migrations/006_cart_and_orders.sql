@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS cart_items (
+    user_id INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    item_name VARCHAR(255) NOT NULL REFERENCES items (name) ON DELETE CASCADE,
+    quantity INT NOT NULL CHECK (quantity > 0),
+    added_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, item_name)
+);
+
+CREATE TABLE IF NOT EXISTS orders (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    total INT NOT NULL CHECK (total >= 0),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE item_purchases
+    ADD COLUMN IF NOT EXISTS order_id INT REFERENCES orders (id) ON DELETE CASCADE;
+
+ALTER TABLE coin_transactions
+    ADD COLUMN IF NOT EXISTS order_id INT REFERENCES orders (id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS item_purchases_order_id_idx ON item_purchases (order_id);
@@ -0,0 +1,7 @@
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS status VARCHAR(32) NOT NULL DEFAULT 'placed'
+        CHECK (status IN ('placed', 'ready_for_pickup', 'delivered', 'cancelled')),
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS orders_user_id_idx ON orders (user_id, created_at);
+CREATE INDEX IF NOT EXISTS orders_status_idx ON orders (status);
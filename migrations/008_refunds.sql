@@ -0,0 +1,5 @@
+ALTER TABLE coin_transactions
+    ADD COLUMN IF NOT EXISTS kind VARCHAR(32) NOT NULL DEFAULT 'transfer';
+
+-- До появления kind покупки кодировались как to_user_id = NULL
+UPDATE coin_transactions SET kind = 'purchase' WHERE to_user_id IS NULL;
@@ -0,0 +1,6 @@
+ALTER TABLE coin_transactions
+    ADD COLUMN IF NOT EXISTS memo TEXT NOT NULL DEFAULT '',
+    ADD CONSTRAINT coin_transactions_kind_check
+        CHECK (kind IN ('transfer', 'purchase', 'refund', 'grant', 'adjustment', 'expiry'));
+
+CREATE INDEX IF NOT EXISTS coin_transactions_order_id_idx ON coin_transactions (order_id);
@@ -0,0 +1,47 @@
+-- Двойная запись: каждая запись coin_transactions раскладывается на проводки,
+-- сумма которых равна нулю. Системные счета: store (магазин) и treasury
+-- (эмиссия стартовых балансов и корректировки).
+CREATE TABLE IF NOT EXISTS ledger_postings (
+    id SERIAL PRIMARY KEY,
+    transaction_id INT NOT NULL REFERENCES coin_transactions (id) ON DELETE CASCADE,
+    user_id INT REFERENCES users (id) ON DELETE CASCADE,
+    system_account VARCHAR(32) CHECK (system_account IN ('store', 'treasury')),
+    amount INT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((user_id IS NULL) <> (system_account IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS ledger_postings_user_id_idx ON ledger_postings (user_id);
+CREATE INDEX IF NOT EXISTS ledger_postings_transaction_id_idx ON ledger_postings (transaction_id);
+
+-- Стартовые балансы существующих пользователей раньше не журналировались
+INSERT INTO coin_transactions (from_user_id, to_user_id, amount, kind, memo)
+SELECT NULL, u.id, 1000, 'grant', 'opening balance'
+FROM users u
+WHERE NOT EXISTS (
+    SELECT 1 FROM coin_transactions t WHERE t.to_user_id = u.id AND t.kind = 'grant'
+);
+
+-- Дебетовая сторона: отправитель или системный счёт
+INSERT INTO ledger_postings (transaction_id, user_id, system_account, amount, created_at)
+SELECT t.id,
+       t.from_user_id,
+       CASE WHEN t.from_user_id IS NOT NULL THEN NULL
+            WHEN t.kind = 'refund' THEN 'store'
+            ELSE 'treasury' END,
+       -t.amount,
+       t.created_at
+FROM coin_transactions t
+WHERE NOT EXISTS (SELECT 1 FROM ledger_postings p WHERE p.transaction_id = t.id);
+
+-- Кредитовая сторона: получатель или системный счёт
+INSERT INTO ledger_postings (transaction_id, user_id, system_account, amount, created_at)
+SELECT t.id,
+       t.to_user_id,
+       CASE WHEN t.to_user_id IS NOT NULL THEN NULL
+            WHEN t.kind = 'purchase' THEN 'store'
+            ELSE 'treasury' END,
+       t.amount,
+       t.created_at
+FROM coin_transactions t
+WHERE (SELECT COUNT(*) FROM ledger_postings p WHERE p.transaction_id = t.id) = 1;
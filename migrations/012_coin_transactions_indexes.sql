@@ -0,0 +1,5 @@
+CREATE INDEX IF NOT EXISTS coin_transactions_from_user_created_idx
+    ON coin_transactions (from_user_id, created_at DESC, id DESC);
+
+CREATE INDEX IF NOT EXISTS coin_transactions_to_user_created_idx
+    ON coin_transactions (to_user_id, created_at DESC, id DESC);
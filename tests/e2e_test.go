@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sync"
 	"testing"
+	"time"
 	"avito-shop/internal/models"
 	"github.com/stretchr/testify/assert"
 )
@@ -74,6 +76,96 @@ func TestE2E(t *testing.T) {
 }
 
 
+// TestE2E_ConcurrentSendCoin: встречные параллельные переводы не теряют и не
+// создают монеты — сумма балансов после всех переводов не меняется.
+func TestE2E_ConcurrentSendCoin(t *testing.T) {
+	baseURL := "http://localhost:8080"
+	suffix := time.Now().UnixNano()
+	userC := fmt.Sprintf("userC_%d", suffix)
+	userD := fmt.Sprintf("userD_%d", suffix)
+
+	tokenC, err := auth(baseURL, userC, "passC")
+	if !assert.NoError(t, err) {
+		return
+	}
+	tokenD, err := auth(baseURL, userD, "passD")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	const workers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_ = sendCoin(baseURL, tokenC, userD, 7)
+		}()
+		go func() {
+			defer wg.Done()
+			_ = sendCoin(baseURL, tokenD, userC, 3)
+		}()
+	}
+	wg.Wait()
+
+	infoC, err := getInfo(baseURL, tokenC)
+	if !assert.NoError(t, err) {
+		return
+	}
+	infoD, err := getInfo(baseURL, tokenD)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, 2000, infoC.Coins+infoD.Coins, "total balance must be preserved")
+	assert.Equal(t, 1000-workers*7+workers*3, infoC.Coins)
+}
+
+
+// TestE2E_IdempotentSendCoin: повтор запроса с тем же Idempotency-Key не
+// списывает монеты второй раз.
+func TestE2E_IdempotentSendCoin(t *testing.T) {
+	baseURL := "http://localhost:8080"
+	suffix := time.Now().UnixNano()
+	userE := fmt.Sprintf("userE_%d", suffix)
+	userF := fmt.Sprintf("userF_%d", suffix)
+
+	tokenE, err := auth(baseURL, userE, "passE")
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = auth(baseURL, userF, "passF")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	key := fmt.Sprintf("transfer-%d", suffix)
+	body, _ := json.Marshal(models.SendCoinRequest{ToUser: userF, Amount: 10})
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest("POST", baseURL+"/api/sendCoin", bytes.NewReader(body))
+		if !assert.NoError(t, err) {
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+tokenE)
+		req.Header.Set("Idempotency-Key", key)
+		resp, err := http.DefaultClient.Do(req)
+		if !assert.NoError(t, err) {
+			return
+		}
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, i == 1, resp.Header.Get("Idempotent-Replayed") == "true")
+	}
+
+	infoE, err := getInfo(baseURL, tokenE)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 990, infoE.Coins)
+}
+
+
 
 
 func auth(baseURL, username, password string) (string, error) {